@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/Microkubes/microservice-registration/config"
+)
+
+// DefaultAddress is the listen address of the admin listener when none is configured.
+const DefaultAddress = ":8090"
+
+// Server is the admin HTTP listener. It serves the operational endpoints on an address
+// separate from the service port, so they are not exposed through the API Gateway.
+type Server struct {
+	// Mux holds the admin endpoints.
+	Mux *http.ServeMux
+
+	server *http.Server
+}
+
+// NewServer creates an admin Server for the given configuration.
+func NewServer(cfg *config.AdminConfig) *Server {
+	addr := DefaultAddress
+	if cfg != nil && cfg.Address != "" {
+		addr = cfg.Address
+	}
+	mux := http.NewServeMux()
+	return &Server{
+		Mux: mux,
+		server: &http.Server{
+			Addr:    addr,
+			Handler: mux,
+		},
+	}
+}
+
+// Use wraps the handler of the admin listener, and so every admin endpoint, with middleware.
+func (s *Server) Use(middleware func(http.Handler) http.Handler) {
+	s.server.Handler = middleware(s.server.Handler)
+}
+
+// Addr returns the listen address of the admin listener.
+func (s *Server) Addr() string {
+	return s.server.Addr
+}
+
+// ListenAndServe starts the admin listener. It blocks until the listener fails or is shut down.
+func (s *Server) ListenAndServe() error {
+	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops the admin listener.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// MountPprof mounts the net/http/pprof profiling endpoints on /debug/pprof/.
+func MountPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// ConfigHandler serves the current configuration, with the secrets redacted. Only GET and
+// HEAD are allowed.
+func ConfigHandler(store *config.Store) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			rw.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(store.Get().String()))
+	})
+}
@@ -14,13 +14,107 @@ import (
 	"context"
 	"github.com/keitaroinc/goa"
 	"net/http"
+	"strconv"
 )
 
+// JwksJwksContext provides the jwks jwks action context.
+type JwksJwksContext struct {
+	context.Context
+	*goa.ResponseData
+	*goa.RequestData
+}
+
+// NewJwksJwksContext parses the incoming request URL and body, performs validations and creates the
+// context used by the jwks controller jwks action.
+func NewJwksJwksContext(ctx context.Context, r *http.Request, service *goa.Service) (*JwksJwksContext, error) {
+	var err error
+	resp := goa.ContextResponse(ctx)
+	resp.Service = service
+	req := goa.ContextRequest(ctx)
+	req.Request = r
+	rctx := JwksJwksContext{Context: ctx, ResponseData: resp, RequestData: req}
+	return &rctx, err
+}
+
+// OK sends a HTTP response with status code 200.
+func (ctx *JwksJwksContext) OK(r *JWKSet) error {
+	if ctx.ResponseData.Header().Get("Content-Type") == "" {
+		ctx.ResponseData.Header().Set("Content-Type", "application/jwk-set+json")
+	}
+	return ctx.ResponseData.Service.Send(ctx.Context, 200, r)
+}
+
+// InternalServerError sends a HTTP response with status code 500.
+func (ctx *JwksJwksContext) InternalServerError(r error) error {
+	if ctx.ResponseData.Header().Get("Content-Type") == "" {
+		ctx.ResponseData.Header().Set("Content-Type", "application/vnd.goa.error")
+	}
+	return ctx.ResponseData.Service.Send(ctx.Context, 500, r)
+}
+
+// ConfirmVerificationUserContext provides the user confirmVerification action context.
+type ConfirmVerificationUserContext struct {
+	context.Context
+	*goa.ResponseData
+	*goa.RequestData
+	ID string
+}
+
+// NewConfirmVerificationUserContext parses the incoming request URL and body, performs validations and creates the
+// context used by the user controller confirmVerification action.
+func NewConfirmVerificationUserContext(ctx context.Context, r *http.Request, service *goa.Service) (*ConfirmVerificationUserContext, error) {
+	var err error
+	resp := goa.ContextResponse(ctx)
+	resp.Service = service
+	req := goa.ContextRequest(ctx)
+	req.Request = r
+	rctx := ConfirmVerificationUserContext{Context: ctx, ResponseData: resp, RequestData: req}
+	paramID := req.Params["id"]
+	if len(paramID) > 0 {
+		rawID := paramID[0]
+		rctx.ID = rawID
+	}
+	return &rctx, err
+}
+
+// OK sends a HTTP response with status code 200.
+func (ctx *ConfirmVerificationUserContext) OK(r *RegistrationStatus) error {
+	if ctx.ResponseData.Header().Get("Content-Type") == "" {
+		ctx.ResponseData.Header().Set("Content-Type", "application/vnd.goa.registration-status+json")
+	}
+	return ctx.ResponseData.Service.Send(ctx.Context, 200, r)
+}
+
+// NotFound sends a HTTP response with status code 404.
+func (ctx *ConfirmVerificationUserContext) NotFound(r error) error {
+	if ctx.ResponseData.Header().Get("Content-Type") == "" {
+		ctx.ResponseData.Header().Set("Content-Type", "application/vnd.goa.error")
+	}
+	return ctx.ResponseData.Service.Send(ctx.Context, 404, r)
+}
+
+// Conflict sends a HTTP response with status code 409.
+func (ctx *ConfirmVerificationUserContext) Conflict(r error) error {
+	if ctx.ResponseData.Header().Get("Content-Type") == "" {
+		ctx.ResponseData.Header().Set("Content-Type", "application/vnd.goa.error")
+	}
+	return ctx.ResponseData.Service.Send(ctx.Context, 409, r)
+}
+
+// InternalServerError sends a HTTP response with status code 500.
+func (ctx *ConfirmVerificationUserContext) InternalServerError(r error) error {
+	if ctx.ResponseData.Header().Get("Content-Type") == "" {
+		ctx.ResponseData.Header().Set("Content-Type", "application/vnd.goa.error")
+	}
+	return ctx.ResponseData.Service.Send(ctx.Context, 500, r)
+}
+
 // RegisterUserContext provides the user register action context.
 type RegisterUserContext struct {
 	context.Context
 	*goa.ResponseData
 	*goa.RequestData
+	Async   *bool
 	Payload *UserPayload
 }
 
@@ -33,6 +127,16 @@ func NewRegisterUserContext(ctx context.Context, r *http.Request, service *goa.S
 	req := goa.ContextRequest(ctx)
 	req.Request = r
 	rctx := RegisterUserContext{Context: ctx, ResponseData: resp, RequestData: req}
+	paramAsync := req.Params["async"]
+	if len(paramAsync) > 0 {
+		rawAsync := paramAsync[0]
+		if async, err2 := strconv.ParseBool(rawAsync); err2 == nil {
+			tmp1 := &async
+			rctx.Async = tmp1
+		} else {
+			err = goa.MergeErrors(err, goa.InvalidParamTypeError("async", rawAsync, "boolean"))
+		}
+	}
 	return &rctx, err
 }
 
@@ -44,6 +148,14 @@ func (ctx *RegisterUserContext) Created(r *Users) error {
 	return ctx.ResponseData.Service.Send(ctx.Context, 201, r)
 }
 
+// Accepted sends a HTTP response with status code 202.
+func (ctx *RegisterUserContext) Accepted(r *RegistrationStatus) error {
+	if ctx.ResponseData.Header().Get("Content-Type") == "" {
+		ctx.ResponseData.Header().Set("Content-Type", "application/vnd.goa.registration-status+json")
+	}
+	return ctx.ResponseData.Service.Send(ctx.Context, 202, r)
+}
+
 // BadRequest sends a HTTP response with status code 400.
 func (ctx *RegisterUserContext) BadRequest(r error) error {
 	if ctx.ResponseData.Header().Get("Content-Type") == "" {
@@ -60,6 +172,63 @@ func (ctx *RegisterUserContext) InternalServerError(r error) error {
 	return ctx.ResponseData.Service.Send(ctx.Context, 500, r)
 }
 
+// ServiceUnavailable sends a HTTP response with status code 503.
+func (ctx *RegisterUserContext) ServiceUnavailable(r error) error {
+	if ctx.ResponseData.Header().Get("Content-Type") == "" {
+		ctx.ResponseData.Header().Set("Content-Type", "application/vnd.goa.error")
+	}
+	return ctx.ResponseData.Service.Send(ctx.Context, 503, r)
+}
+
+// RegistrationStatusUserContext provides the user registrationStatus action context.
+type RegistrationStatusUserContext struct {
+	context.Context
+	*goa.ResponseData
+	*goa.RequestData
+	ID string
+}
+
+// NewRegistrationStatusUserContext parses the incoming request URL and body, performs validations and creates the
+// context used by the user controller registrationStatus action.
+func NewRegistrationStatusUserContext(ctx context.Context, r *http.Request, service *goa.Service) (*RegistrationStatusUserContext, error) {
+	var err error
+	resp := goa.ContextResponse(ctx)
+	resp.Service = service
+	req := goa.ContextRequest(ctx)
+	req.Request = r
+	rctx := RegistrationStatusUserContext{Context: ctx, ResponseData: resp, RequestData: req}
+	paramID := req.Params["id"]
+	if len(paramID) > 0 {
+		rawID := paramID[0]
+		rctx.ID = rawID
+	}
+	return &rctx, err
+}
+
+// OK sends a HTTP response with status code 200.
+func (ctx *RegistrationStatusUserContext) OK(r *RegistrationStatus) error {
+	if ctx.ResponseData.Header().Get("Content-Type") == "" {
+		ctx.ResponseData.Header().Set("Content-Type", "application/vnd.goa.registration-status+json")
+	}
+	return ctx.ResponseData.Service.Send(ctx.Context, 200, r)
+}
+
+// NotFound sends a HTTP response with status code 404.
+func (ctx *RegistrationStatusUserContext) NotFound(r error) error {
+	if ctx.ResponseData.Header().Get("Content-Type") == "" {
+		ctx.ResponseData.Header().Set("Content-Type", "application/vnd.goa.error")
+	}
+	return ctx.ResponseData.Service.Send(ctx.Context, 404, r)
+}
+
+// InternalServerError sends a HTTP response with status code 500.
+func (ctx *RegistrationStatusUserContext) InternalServerError(r error) error {
+	if ctx.ResponseData.Header().Get("Content-Type") == "" {
+		ctx.ResponseData.Header().Set("Content-Type", "application/vnd.goa.error")
+	}
+	return ctx.ResponseData.Service.Send(ctx.Context, 500, r)
+}
+
 // ResendVerificationUserContext provides the user resendVerification action context.
 type ResendVerificationUserContext struct {
 	context.Context
@@ -32,6 +32,33 @@ func initService(service *goa.Service) {
 	service.Decoder.Register(goa.NewJSONDecoder, "*/*")
 }
 
+// JwksController is the controller interface for the Jwks actions.
+type JwksController interface {
+	goa.Muxer
+	Jwks(*JwksJwksContext) error
+}
+
+// MountJwksController "mounts" a Jwks resource controller on the given service.
+func MountJwksController(service *goa.Service, ctrl JwksController) {
+	initService(service)
+	var h goa.Handler
+
+	h = func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		// Check if there was an error loading the request
+		if err := goa.ContextError(ctx); err != nil {
+			return err
+		}
+		// Build the context
+		rctx, err := NewJwksJwksContext(ctx, req, service)
+		if err != nil {
+			return err
+		}
+		return ctrl.Jwks(rctx)
+	}
+	service.Mux.Handle("GET", "/.well-known/jwks.json", ctrl.MuxHandler("jwks", h, nil))
+	service.LogInfo("mount", "ctrl", "Jwks", "action", "Jwks", "route", "GET /.well-known/jwks.json")
+}
+
 // SwaggerController is the controller interface for the Swagger actions.
 type SwaggerController interface {
 	goa.Muxer
@@ -59,7 +86,9 @@ func MountSwaggerController(service *goa.Service, ctrl SwaggerController) {
 // UserController is the controller interface for the User actions.
 type UserController interface {
 	goa.Muxer
+	ConfirmVerification(*ConfirmVerificationUserContext) error
 	Register(*RegisterUserContext) error
+	RegistrationStatus(*RegistrationStatusUserContext) error
 	ResendVerification(*ResendVerificationUserContext) error
 }
 
@@ -67,9 +96,27 @@ type UserController interface {
 func MountUserController(service *goa.Service, ctrl UserController) {
 	initService(service)
 	var h goa.Handler
+	service.Mux.Handle("OPTIONS", "/users/register/:id/verified", ctrl.MuxHandler("preflight", handleUserOrigin(cors.HandlePreflight()), nil))
 	service.Mux.Handle("OPTIONS", "/users/register", ctrl.MuxHandler("preflight", handleUserOrigin(cors.HandlePreflight()), nil))
+	service.Mux.Handle("OPTIONS", "/users/register/:id/status", ctrl.MuxHandler("preflight", handleUserOrigin(cors.HandlePreflight()), nil))
 	service.Mux.Handle("OPTIONS", "/users/register/resend-verification", ctrl.MuxHandler("preflight", handleUserOrigin(cors.HandlePreflight()), nil))
 
+	h = func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		// Check if there was an error loading the request
+		if err := goa.ContextError(ctx); err != nil {
+			return err
+		}
+		// Build the context
+		rctx, err := NewConfirmVerificationUserContext(ctx, req, service)
+		if err != nil {
+			return err
+		}
+		return ctrl.ConfirmVerification(rctx)
+	}
+	h = handleUserOrigin(h)
+	service.Mux.Handle("POST", "/users/register/:id/verified", ctrl.MuxHandler("confirmVerification", h, nil))
+	service.LogInfo("mount", "ctrl", "User", "action", "ConfirmVerification", "route", "POST /users/register/:id/verified")
+
 	h = func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
 		// Check if there was an error loading the request
 		if err := goa.ContextError(ctx); err != nil {
@@ -92,6 +139,22 @@ func MountUserController(service *goa.Service, ctrl UserController) {
 	service.Mux.Handle("POST", "/users/register", ctrl.MuxHandler("register", h, unmarshalRegisterUserPayload))
 	service.LogInfo("mount", "ctrl", "User", "action", "Register", "route", "POST /users/register")
 
+	h = func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		// Check if there was an error loading the request
+		if err := goa.ContextError(ctx); err != nil {
+			return err
+		}
+		// Build the context
+		rctx, err := NewRegistrationStatusUserContext(ctx, req, service)
+		if err != nil {
+			return err
+		}
+		return ctrl.RegistrationStatus(rctx)
+	}
+	h = handleUserOrigin(h)
+	service.Mux.Handle("GET", "/users/register/:id/status", ctrl.MuxHandler("registrationStatus", h, nil))
+	service.LogInfo("mount", "ctrl", "User", "action", "RegistrationStatus", "route", "GET /users/register/:id/status")
+
 	h = func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
 		// Check if there was an error loading the request
 		if err := goa.ContextError(ctx); err != nil {
@@ -12,8 +12,115 @@ package app
 
 import (
 	"github.com/keitaroinc/goa"
+	"time"
 )
 
+// Public JSON Web Key (RFC 7517) (default view)
+//
+// Identifier: application/jwk+json; view=default
+type JWK struct {
+	// Signing algorithm
+	Alg string `form:"alg" json:"alg" yaml:"alg" xml:"alg"`
+	// Curve of an EC or OKP key
+	Crv *string `form:"crv,omitempty" json:"crv,omitempty" yaml:"crv,omitempty" xml:"crv,omitempty"`
+	// RSA public exponent
+	E *string `form:"e,omitempty" json:"e,omitempty" yaml:"e,omitempty" xml:"e,omitempty"`
+	// Key ID, the RFC 7638 thumbprint of the key
+	Kid string `form:"kid" json:"kid" yaml:"kid" xml:"kid"`
+	// Key type (RSA, EC or OKP)
+	Kty string `form:"kty" json:"kty" yaml:"kty" xml:"kty"`
+	// RSA modulus
+	N *string `form:"n,omitempty" json:"n,omitempty" yaml:"n,omitempty" xml:"n,omitempty"`
+	// Public key use
+	Use string `form:"use" json:"use" yaml:"use" xml:"use"`
+	// X coordinate of an EC key or the OKP public key
+	X *string `form:"x,omitempty" json:"x,omitempty" yaml:"x,omitempty" xml:"x,omitempty"`
+	// Y coordinate of an EC key
+	Y *string `form:"y,omitempty" json:"y,omitempty" yaml:"y,omitempty" xml:"y,omitempty"`
+}
+
+// Validate validates the JWK media type instance.
+func (mt *JWK) Validate() (err error) {
+	if mt.Kty == "" {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "kty"))
+	}
+	if mt.Kid == "" {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "kid"))
+	}
+	if mt.Use == "" {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "use"))
+	}
+	if mt.Alg == "" {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "alg"))
+	}
+	return
+}
+
+// JSON Web Key Set (RFC 7517) (default view)
+//
+// Identifier: application/jwk-set+json; view=default
+type JWKSet struct {
+	// Public keys
+	Keys []*JWK `form:"keys" json:"keys" yaml:"keys" xml:"keys"`
+}
+
+// Validate validates the JWKSet media type instance.
+func (mt *JWKSet) Validate() (err error) {
+	if mt.Keys == nil {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "keys"))
+	}
+	for _, e := range mt.Keys {
+		if e != nil {
+			if err2 := e.Validate(); err2 != nil {
+				err = goa.MergeErrors(err, err2)
+			}
+		}
+	}
+	return
+}
+
+// Where a registration is in its lifecycle (default view)
+//
+// Identifier: application/vnd.goa.registration-status+json; view=default
+type RegistrationStatus struct {
+	// When the registration started
+	CreatedAt time.Time `form:"createdAt" json:"createdAt" yaml:"createdAt" xml:"createdAt"`
+	// The error that failed the registration
+	Error *string `form:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty" xml:"error,omitempty"`
+	// The state changes, oldest first
+	History []*RegistrationTransition `form:"history" json:"history" yaml:"history" xml:"history"`
+	// Registration ID
+	ID string `form:"id" json:"id" yaml:"id" xml:"id"`
+	// Current state: pending, user_created, profile_created, mail_queued, verified or failed
+	State string `form:"state" json:"state" yaml:"state" xml:"state"`
+	// When the registration last changed state
+	UpdatedAt time.Time `form:"updatedAt" json:"updatedAt" yaml:"updatedAt" xml:"updatedAt"`
+	// ID of the created user
+	UserID *string `form:"userId,omitempty" json:"userId,omitempty" yaml:"userId,omitempty" xml:"userId,omitempty"`
+}
+
+// Validate validates the RegistrationStatus media type instance.
+func (mt *RegistrationStatus) Validate() (err error) {
+	if mt.ID == "" {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "id"))
+	}
+	if mt.State == "" {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "state"))
+	}
+
+	if mt.History == nil {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`response`, "history"))
+	}
+	for _, e := range mt.History {
+		if e != nil {
+			if err2 := e.Validate(); err2 != nil {
+				err = goa.MergeErrors(err, err2)
+			}
+		}
+	}
+	return
+}
+
 // users media type (default view)
 //
 // Identifier: application/vnd.goa.user+json; view=default
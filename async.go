@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Microkubes/microservice-registration/config"
+	"github.com/Microkubes/microservice-registration/metrics"
+	"github.com/Microkubes/microservice-registration/retry"
+	"github.com/keitaroinc/goa"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errQueueFull is the error of a registration not accepted because the queue is full.
+var errQueueFull = goa.NewErrorClass("queue_full", http.StatusServiceUnavailable)
+
+// AsyncRegistrar processes the accepted registrations on a pool of workers. A failed step
+// is retried with backoff, continuing with the steps that did not complete; a registration
+// rejected by a downstream service is not retried. A failed user creation is retried only
+// when it is idempotent: the user may have been created by a request that failed.
+type AsyncRegistrar struct {
+	// Default is set when the registrations are asynchronous unless a request asks otherwise.
+	Default bool
+
+	controller *UserController
+	policy     *retry.Policy
+	jobs       chan *registrationJob
+
+	// mu guards closed, so no job is queued after the queue was closed
+	mu     sync.RWMutex
+	closed bool
+	// stop is closed on Close, to stop waiting for the retries
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewAsyncRegistrar starts the workers processing the registrations of the controller.
+func NewAsyncRegistrar(controller *UserController, cfg *config.AsyncConfig) *AsyncRegistrar {
+	initial, max := cfg.Backoff()
+	a := &AsyncRegistrar{
+		Default:    cfg.IsEnabled(),
+		controller: controller,
+		policy: &retry.Policy{
+			MaxAttempts:    cfg.Attempts(),
+			InitialBackoff: initial,
+			MaxBackoff:     max,
+			Multiplier:     2,
+			Jitter:         0.2,
+		},
+		jobs: make(chan *registrationJob, cfg.Capacity()),
+		stop: make(chan struct{}),
+	}
+	for i := 0; i < cfg.WorkerCount(); i++ {
+		a.wg.Add(1)
+		go a.work()
+	}
+	return a
+}
+
+// Enqueue queues the registration. It returns false when the queue is full or closed.
+func (a *AsyncRegistrar) Enqueue(job *registrationJob) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return false
+	}
+	select {
+	case a.jobs <- job:
+		metrics.AsyncQueued.Inc()
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops accepting registrations and waits for the workers until ctx is done. The
+// running registrations finish their current attempt; the queued ones and those waiting
+// for a retry are failed, as the payloads are not persisted. The registrations still
+// running when ctx is done are failed on the next start.
+func (a *AsyncRegistrar) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.stop)
+		close(a.jobs)
+	}
+	a.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *AsyncRegistrar) work() {
+	defer a.wg.Done()
+	for job := range a.jobs {
+		metrics.AsyncQueued.Dec()
+		a.process(job)
+	}
+}
+
+// process runs the registration until it completes, is rejected or runs out of attempts.
+func (a *AsyncRegistrar) process(job *registrationJob) {
+	c, ctx := a.controller, job.ctx
+	result := &registerResult{registrationID: job.registrationID}
+	status := http.StatusCreated
+
+	for attempt := 1; ; attempt++ {
+		if a.stopped() {
+			result.errorClass, status = metrics.ErrorShutdown, http.StatusServiceUnavailable
+			break
+		}
+		err := c.runRegistration(ctx, job)
+		if err == nil {
+			goa.LogInfo(ctx, "New user registered.", "id", job.userID(), "registration", job.registrationID)
+			break
+		}
+		result.errorClass, status = metrics.ErrorInternal, http.StatusInternalServerError
+		if regErr, ok := err.(*registrationError); ok {
+			result.errorClass = regErr.class
+			if regErr.rejected {
+				status = http.StatusBadRequest
+				break
+			}
+		}
+		if job.user == nil && !c.Retrier.IdempotentCreate {
+			// without the idempotency key a retry could create the user twice
+			break
+		}
+		if attempt >= a.policy.MaxAttempts {
+			break
+		}
+		goa.LogInfo(ctx, "Register: retrying the registration", "registration", job.registrationID, "attempt", attempt, "err", err.Error())
+		select {
+		case <-a.stop:
+		case <-time.After(a.policy.Backoff(attempt)):
+		}
+	}
+
+	result.userID = job.userID()
+	if status >= 400 {
+		c.compensate(ctx, job)
+	}
+	c.completeRegistration(ctx, job.audit, result, status)
+}
+
+func (a *AsyncRegistrar) stopped() bool {
+	select {
+	case <-a.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// detach returns a context for processing the request after the response was sent: it
+// keeps the logger and the trace of the request, but not its cancellation.
+func detach(ctx context.Context) context.Context {
+	detached := goa.WithLogger(context.Background(), goa.ContextLogger(ctx))
+	return trace.ContextWithSpanContext(detached, trace.SpanContextFromContext(ctx))
+}
@@ -0,0 +1,233 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audit event types.
+const (
+	// RegistrationAttempt is recorded when a registration request is received.
+	RegistrationAttempt = "registration.attempt"
+	// RegistrationSucceeded is recorded when a user is registered.
+	RegistrationSucceeded = "registration.succeeded"
+	// RegistrationRejected is recorded when the user or the profile is rejected by the
+	// policies of the user or user profile microservice.
+	RegistrationRejected = "registration.rejected"
+	// RegistrationFailed is recorded when a registration fails.
+	RegistrationFailed = "registration.failed"
+	// VerificationResent is recorded when a verification email is resent.
+	VerificationResent = "verification.resent"
+	// AdminRequest is recorded for every request to the admin listener.
+	AdminRequest = "admin.request"
+	// ConfigReloaded is recorded when the configuration is reloaded.
+	ConfigReloaded = "admin.config_reloaded"
+	// ConfigReloadRejected is recorded when a configuration reload is rejected.
+	ConfigReloadRejected = "admin.config_reload_rejected"
+)
+
+// Event is an entry of the audit log. Seq, Time, PrevHash and Hash are set when the event
+// is recorded. Hash is the SHA-256 of the JSON encoded entry without the hash, and
+// PrevHash the hash of the previous entry, so removing or changing an entry breaks the
+// chain.
+type Event struct {
+	Seq       uint64            `json:"seq"`
+	Time      time.Time         `json:"time"`
+	Type      string            `json:"type"`
+	RequestID string            `json:"requestId,omitempty"`
+	RemoteIP  string            `json:"remoteIp,omitempty"`
+	Email     string            `json:"email,omitempty"`
+	UserID    string            `json:"userId,omitempty"`
+	Roles     []string          `json:"roles,omitempty"`
+	Outcome   string            `json:"outcome,omitempty"`
+	Reason    string            `json:"reason,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	PrevHash  string            `json:"prevHash"`
+	Hash      string            `json:"hash"`
+}
+
+// hash returns the hash of the event.
+func (e Event) hash() (string, error) {
+	e.Hash = ""
+	js, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(js)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Sink stores the audit entries, one JSON encoded entry per call.
+type Sink interface {
+	Write(entry []byte) error
+	Close() error
+}
+
+// syncer is implemented by the sinks that buffer the written entries. Sync is called
+// outside of the log lock, so that the concurrent records can share one flush.
+type syncer interface {
+	Sync() error
+}
+
+// resumer is implemented by the sinks that can read back their last entry, so that the
+// chain continues across restarts.
+type resumer interface {
+	Last() (seq uint64, hash string)
+}
+
+// Log is the append-only, hash chained audit log. A nil *Log records nothing.
+type Log struct {
+	mu   sync.Mutex
+	sink Sink
+	seq  uint64
+	last string
+	now  func() time.Time
+}
+
+// New returns a Log writing to sink, continuing the chain of the entries already in the
+// sink when it can read them back.
+func New(sink Sink) *Log {
+	l := &Log{sink: sink, now: time.Now}
+	if r, ok := sink.(resumer); ok {
+		l.seq, l.last = r.Last()
+	}
+	return l
+}
+
+// Record chains the event to the previous entry and writes it to the sink. It returns
+// once the sink flushed the entry.
+func (l *Log) Record(event Event) error {
+	if l == nil {
+		return nil
+	}
+	if err := l.write(event); err != nil {
+		return err
+	}
+	if s, ok := l.sink.(syncer); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+func (l *Log) write(event Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	event.Seq = l.seq + 1
+	event.Time = l.now().UTC()
+	event.PrevHash = l.last
+	hash, err := event.hash()
+	if err != nil {
+		return err
+	}
+	event.Hash = hash
+	entry, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := l.sink.Write(entry); err != nil {
+		return err
+	}
+	l.seq, l.last = event.Seq, hash
+	return nil
+}
+
+// Close closes the sink.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sink.Close()
+}
+
+// Verify checks the hash chain of the audit entries read from r, one JSON entry per line,
+// and returns the number of entries. The first entry may continue the chain of a rotated
+// file; every following entry must link to the one before it.
+func Verify(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	n := 0
+	var previous *Event
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return n, fmt.Errorf("entry %d: %s", n+1, err)
+		}
+		hash, err := event.hash()
+		if err != nil {
+			return n, err
+		}
+		if hash != event.Hash {
+			return n, fmt.Errorf("entry %d (seq %d) was modified", n+1, event.Seq)
+		}
+		if previous != nil && (event.PrevHash != previous.Hash || event.Seq != previous.Seq+1) {
+			return n, fmt.Errorf("entry %d (seq %d) does not follow seq %d", n+1, event.Seq, previous.Seq)
+		}
+		previous = &event
+		n++
+	}
+	return n, scanner.Err()
+}
+
+// RemoteIP returns the IP address the request came from. X-Forwarded-For is not
+// trusted, use ForwardedIP for the requests that came through the API Gateway.
+func RemoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// ForwardedIP returns the IP address of the client of a request that came through the
+// API Gateway: the last address of X-Forwarded-For, which is the one the gateway added,
+// as the addresses before it are sent by the client. Without the header it returns
+// RemoteIP.
+func ForwardedIP(req *http.Request) string {
+	forwarded := req.Header.Get("X-Forwarded-For")
+	if forwarded == "" {
+		return RemoteIP(req)
+	}
+	addresses := strings.Split(forwarded, ",")
+	return strings.TrimSpace(addresses[len(addresses)-1])
+}
+
+// Handler records an AdminRequest event for every request, except the requests to the
+// quiet paths such as the probes and the metrics scrapes, and passes it on to h. The
+// requests are not routed through the API Gateway, so RemoteIP is recorded.
+func Handler(log *Log, h http.Handler, onError func(error), quiet ...string) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		for _, path := range quiet {
+			if req.URL.Path == path {
+				h.ServeHTTP(rw, req)
+				return
+			}
+		}
+		err := log.Record(Event{
+			Type:     AdminRequest,
+			RemoteIP: RemoteIP(req),
+			Details: map[string]string{
+				"method": req.Method,
+				"path":   req.URL.Path,
+			},
+		})
+		if err != nil {
+			onError(err)
+		}
+		h.ServeHTTP(rw, req)
+	})
+}
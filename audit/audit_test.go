@@ -0,0 +1,266 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Microkubes/microservice-registration/config"
+	"github.com/Microkubes/microservice-tools/rabbitmq"
+)
+
+// memorySink keeps the entries in memory.
+type memorySink struct {
+	entries [][]byte
+	err     error
+}
+
+func (m *memorySink) Write(entry []byte) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *memorySink) Close() error { return nil }
+
+func (m *memorySink) log() string {
+	return string(bytes.Join(m.entries, []byte("\n")))
+}
+
+func TestHashChain(t *testing.T) {
+	sink := &memorySink{}
+	log := New(sink)
+	for _, event := range []Event{
+		{Type: RegistrationAttempt, Email: "jane@example.com", RemoteIP: "10.0.0.1", Roles: []string{"user"}},
+		{Type: RegistrationSucceeded, Email: "jane@example.com", UserID: "5980", Outcome: "success"},
+		{Type: VerificationResent, Email: "jane@example.com", Outcome: "success"},
+	} {
+		if err := log.Record(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := Verify(strings.NewReader(sink.log())); err != nil || n != 3 {
+		t.Fatalf("expected a valid chain of 3 entries, got %d, %v", n, err)
+	}
+
+	tampered := strings.Replace(sink.log(), `"userId":"5980"`, `"userId":"6000"`, 1)
+	if _, err := Verify(strings.NewReader(tampered)); err == nil || !strings.Contains(err.Error(), "(seq 2) was modified") {
+		t.Fatalf("expected the modified entry to be detected, got %v", err)
+	}
+
+	removed := string(sink.entries[0]) + "\n" + string(sink.entries[2])
+	if _, err := Verify(strings.NewReader(removed)); err == nil || !strings.Contains(err.Error(), "does not follow seq 1") {
+		t.Fatalf("expected the removed entry to be detected, got %v", err)
+	}
+
+	sink.err = errors.New("disk full")
+	if err := log.Record(Event{Type: RegistrationAttempt}); err == nil {
+		t.Fatal("expected the sink error")
+	}
+	var nilLog *Log
+	if err := nilLog.Record(Event{Type: RegistrationAttempt}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	sink, err := NewFileSink(path, 600, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := New(sink)
+	for i := 0; i < 4; i++ {
+		if err := log.Record(Event{Type: RegistrationAttempt, Email: "jane@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log.Close()
+
+	// the chain continues after a restart
+	sink, err = NewFileSink(path, 600, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log = New(sink)
+	if err := log.Record(Event{Type: ConfigReloaded}); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+
+	var all bytes.Buffer
+	for _, file := range []string{path + ".2", path + ".1", path} {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("expected the rotated file %s: %s", file, err)
+		}
+		all.Write(data)
+	}
+	if n, err := Verify(&all); err != nil || n != 5 {
+		t.Fatalf("expected a valid chain of 5 entries across the files, got %d, %v", n, err)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatal("expected at most 2 rotated files")
+	}
+}
+
+func TestOpenSink(t *testing.T) {
+	sink, err := OpenSink(nil, nil)
+	if err != nil || sink != Discard {
+		t.Fatalf("expected the discard sink, got %v, %v", sink, err)
+	}
+
+	dial := func() (rabbitmq.Channel, func() error, error) {
+		return &rabbitmq.MockAMQPChannel{}, func() error { return nil }, nil
+	}
+	sink, err = OpenSink(&config.AuditConfig{Sink: config.AuditAMQP}, dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue := sink.(*QueueSink).queue; queue != DefaultQueue {
+		t.Fatalf("expected the default queue, got %s", queue)
+	}
+
+	unreachable := func() (rabbitmq.Channel, func() error, error) {
+		return nil, nil, errors.New("connection refused")
+	}
+	if _, err := OpenSink(&config.AuditConfig{Sink: config.AuditAMQP}, unreachable); err == nil {
+		t.Fatal("expected the connection error")
+	}
+
+	if _, err := OpenSink(&config.AuditConfig{Sink: "kafka"}, nil); err == nil {
+		t.Fatal("expected an error for an unknown sink")
+	}
+}
+
+// brokenChannel fails every Send once the broker was restarted.
+type brokenChannel struct {
+	rabbitmq.MockAMQPChannel
+	broken *bool
+	sent   *[]string
+}
+
+func (b *brokenChannel) Send(name string, body []byte) error {
+	if *b.broken {
+		return errors.New("channel/connection is not open")
+	}
+	*b.sent = append(*b.sent, string(body))
+	return nil
+}
+
+func TestQueueSinkReconnect(t *testing.T) {
+	var sent []string
+	dials, closed := 0, 0
+	var channels []*bool
+	sink := NewQueueSink(func() (rabbitmq.Channel, func() error, error) {
+		dials++
+		broken := false
+		channels = append(channels, &broken)
+		return &brokenChannel{broken: &broken, sent: &sent}, func() error { closed++; return nil }, nil
+	}, "audit")
+
+	if err := sink.Write([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	// the broker restarts
+	*channels[0] = true
+	if err := sink.Write([]byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	if dials != 2 || closed != 1 || strings.Join(sent, ",") != "first,second" {
+		t.Fatalf("expected the entry published on a new connection, got %d dials, %d closed, %v", dials, closed, sent)
+	}
+	if err := sink.Close(); err != nil || closed != 2 {
+		t.Fatalf("expected the connection to be closed, got %v", err)
+	}
+}
+
+func TestFileSinkConcurrentRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	sink, err := NewFileSink(path, 1024*1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := New(sink)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := log.Record(Event{Type: RegistrationAttempt}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if sink.synced != 20 {
+		t.Fatalf("expected all the entries to be flushed, got %d", sink.synced)
+	}
+	log.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := Verify(bytes.NewReader(data)); err != nil || n != 20 {
+		t.Fatalf("expected a valid chain of 20 entries, got %d, %v", n, err)
+	}
+}
+
+func TestForwardedIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/users/register", nil)
+	req.RemoteAddr = "10.0.0.2:41234"
+	if ip := ForwardedIP(req); ip != "10.0.0.2" {
+		t.Fatalf("expected the remote address without X-Forwarded-For, got %s", ip)
+	}
+	req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7")
+	if ip := ForwardedIP(req); ip != "203.0.113.7" {
+		t.Fatalf("expected the address added by the gateway, got %s", ip)
+	}
+	if ip := RemoteIP(req); ip != "10.0.0.2" {
+		t.Fatalf("expected X-Forwarded-For to be ignored, got %s", ip)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	sink := &memorySink{}
+	handler := Handler(New(sink), http.NotFoundHandler(), func(err error) { t.Fatal(err) }, "/metrics")
+
+	for _, path := range []string{"/config", "/metrics"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "10.0.0.1:52100"
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(sink.entries) != 1 {
+		t.Fatalf("expected only the /config request to be recorded, got %s", sink.log())
+	}
+	for _, expected := range []string{`"type":"admin.request"`, `"remoteIp":"10.0.0.1"`, `"path":"/config"`} {
+		if !strings.Contains(sink.log(), expected) {
+			t.Errorf("expected %s in %s", expected, sink.log())
+		}
+	}
+}
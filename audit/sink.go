@@ -0,0 +1,332 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"os"
+	"sync"
+
+	"github.com/Microkubes/microservice-registration/config"
+	"github.com/Microkubes/microservice-tools/rabbitmq"
+)
+
+// Defaults of the audit sinks.
+const (
+	DefaultMaxSizeMB  = 100
+	DefaultMaxBackups = 10
+	DefaultSyslogTag  = "microservice-registration"
+	DefaultQueue      = "audit-log"
+)
+
+// Dialer opens a channel for the amqp sink and returns it with a function closing its
+// connection.
+type Dialer func() (rabbitmq.Channel, func() error, error)
+
+// OpenSink opens the sink configured in cfg. dial opens the channel of the amqp sink and
+// is not used by the other sinks.
+func OpenSink(cfg *config.AuditConfig, dial Dialer) (Sink, error) {
+	switch cfg.SinkType() {
+	case config.AuditNone:
+		return Discard, nil
+	case config.AuditFile:
+		maxSizeMB, maxBackups := cfg.MaxSizeMB, cfg.MaxBackups
+		if maxSizeMB == 0 {
+			maxSizeMB = DefaultMaxSizeMB
+		}
+		if maxBackups == 0 {
+			maxBackups = DefaultMaxBackups
+		}
+		return NewFileSink(cfg.File, int64(maxSizeMB)*1024*1024, maxBackups)
+	case config.AuditSyslog:
+		tag := cfg.SyslogTag
+		if tag == "" {
+			tag = DefaultSyslogTag
+		}
+		return NewSyslogSink(cfg.SyslogNetwork, cfg.SyslogAddress, tag)
+	case config.AuditAMQP:
+		queue := cfg.Queue
+		if queue == "" {
+			queue = DefaultQueue
+		}
+		// connect at startup, so that a broker that is not reachable is reported early
+		sink := NewQueueSink(dial, queue)
+		if err := sink.connect(); err != nil {
+			return nil, err
+		}
+		return sink, nil
+	}
+	return nil, fmt.Errorf("unknown audit sink %q", cfg.Sink)
+}
+
+// Discard is a Sink that drops the entries.
+var Discard Sink = discard{}
+
+type discard struct{}
+
+func (discard) Write([]byte) error { return nil }
+func (discard) Close() error       { return nil }
+
+// FileSink appends the entries to a file, one per line. When the file would grow over
+// maxSize it is rotated: file becomes file.1, file.1 becomes file.2 and so on, keeping
+// maxBackups rotated files. The chain continues across the rotated files.
+//
+// Write does not flush the entry to disk, Sync does. The concurrent Syncs share one
+// fsync, so the requests recording at the same time do not wait for an fsync each.
+type FileSink struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+	lastSeq    uint64
+	lastHash   string
+	// written and synced count the entries written and flushed to disk
+	written uint64
+	synced  uint64
+
+	// syncMu serializes the fsyncs
+	syncMu sync.Mutex
+}
+
+// NewFileSink opens the audit log file, creating it when missing, and reads back its last
+// entry.
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.readLast(path); err != nil {
+		return nil, err
+	}
+	if s.lastHash == "" {
+		// the current file was just rotated, the chain continues from the last backup
+		if err := s.readLast(path + ".1"); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// readLast reads the sequence number and the hash of the last entry in the file.
+func (s *FileSink) readLast(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err == nil && event.Hash != "" {
+			s.lastSeq, s.lastHash = event.Seq, event.Hash
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file, s.size = file, info.Size()
+	return nil
+}
+
+// Last returns the sequence number and the hash of the last entry.
+func (s *FileSink) Last() (uint64, string) {
+	return s.lastSeq, s.lastHash
+}
+
+// Write appends the entry to the file, rotating it first when it would grow over the
+// maximum size.
+func (s *FileSink) Write(entry []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	line := append(entry, '\n')
+	if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	s.written++
+	return nil
+}
+
+// Sync flushes the written entries to disk. A Sync waiting for the fsync in progress
+// returns without an fsync of its own when that one covered its entries.
+func (s *FileSink) Sync() error {
+	s.mu.Lock()
+	target := s.written
+	s.mu.Unlock()
+
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	s.mu.Lock()
+	file, written, synced := s.file, s.written, s.synced
+	s.mu.Unlock()
+	if synced >= target {
+		return nil
+	}
+
+	err := file.Sync()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if file != s.file {
+		// the file was rotated, which flushed it before closing it
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if written > s.synced {
+		s.synced = written
+	}
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.synced = s.written
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxBackups))
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+	if s.maxBackups > 0 {
+		if err := os.Rename(s.path, s.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+// Close flushes and closes the file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.file.Sync(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// SyslogSink sends the entries to syslog with the auth facility.
+type SyslogSink struct {
+	writer *syslog.Writer
+}
+
+// NewSyslogSink connects to the syslog server at address over network, or to the local
+// syslog daemon when network is empty.
+func NewSyslogSink(network, address, tag string) (*SyslogSink, error) {
+	writer, err := syslog.Dial(network, address, syslog.LOG_AUTH|syslog.LOG_NOTICE, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{writer: writer}, nil
+}
+
+// Write sends the entry to syslog.
+func (s *SyslogSink) Write(entry []byte) error {
+	return s.writer.Notice(string(entry))
+}
+
+// Close closes the connection to the syslog server.
+func (s *SyslogSink) Close() error {
+	return s.writer.Close()
+}
+
+// QueueSink publishes the entries to a RabbitMQ queue. The connection is opened again
+// when a publish fails, so the sink recovers from a broker restart.
+type QueueSink struct {
+	dial  Dialer
+	queue string
+
+	mu    sync.Mutex
+	ch    rabbitmq.Channel
+	close func() error
+}
+
+// NewQueueSink returns a QueueSink publishing to queue over the channels opened with dial.
+// The channel is opened on the first Write.
+func NewQueueSink(dial Dialer, queue string) *QueueSink {
+	return &QueueSink{dial: dial, queue: queue}
+}
+
+// Write publishes the entry. When the publish fails, the connection is opened again and
+// the entry published once more.
+func (s *QueueSink) Write(entry []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+	if err := s.ch.Send(s.queue, entry); err == nil {
+		return nil
+	}
+	s.disconnect()
+	if err := s.connect(); err != nil {
+		return err
+	}
+	if err := s.ch.Send(s.queue, entry); err != nil {
+		s.disconnect()
+		return err
+	}
+	return nil
+}
+
+// connect opens the channel.
+func (s *QueueSink) connect() error {
+	ch, closeConn, err := s.dial()
+	if err != nil {
+		return err
+	}
+	s.ch, s.close = ch, closeConn
+	return nil
+}
+
+// disconnect closes the connection, ignoring the errors of a broken connection.
+func (s *QueueSink) disconnect() {
+	if s.close != nil {
+		s.close()
+	}
+	s.ch, s.close = nil, nil
+}
+
+// Close closes the connection.
+func (s *QueueSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.close == nil {
+		return nil
+	}
+	err := s.close()
+	s.ch, s.close = nil, nil
+	return err
+}
@@ -0,0 +1,112 @@
+package certificate
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Certificate is a TLS server certificate that is reloaded when its files change, so a
+// renewed certificate is served without a restart.
+type Certificate struct {
+	certFile string
+	keyFile  string
+
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	stamp stamp
+}
+
+// stamp identifies a version of the certificate and key files.
+type stamp struct {
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+// New creates a Certificate for the PEM encoded certificate and key files.
+func New(certFile, keyFile string) *Certificate {
+	return &Certificate{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+}
+
+// Load loads the certificate. On error the current certificate stays in use.
+func (c *Certificate) Load() error {
+	st, err := c.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("certificate %s: %s", c.certFile, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.stamp = st
+	return nil
+}
+
+// GetCertificate returns the current certificate. It is meant for tls.Config.GetCertificate.
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.cert == nil {
+		return nil, fmt.Errorf("certificate %s is not loaded", c.certFile)
+	}
+	return c.cert, nil
+}
+
+// TLSConfig returns a server TLS configuration serving the current certificate.
+func (c *Certificate) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.GetCertificate,
+	}
+}
+
+// Watch polls the certificate files every interval and reloads the certificate when
+// they change. Reload errors are passed to onError. Watch blocks until stop is closed.
+func (c *Certificate) Watch(interval time.Duration, stop <-chan struct{}, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			st, err := c.stat()
+			if err != nil {
+				onError(err)
+				continue
+			}
+			c.mu.RLock()
+			changed := st != c.stamp
+			c.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := c.Load(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func (c *Certificate) stat() (stamp, error) {
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return stamp{}, err
+	}
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return stamp{}, err
+	}
+	return stamp{
+		certModTime: certInfo.ModTime(),
+		keyModTime:  keyInfo.ModTime(),
+	}, nil
+}
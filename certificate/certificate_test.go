@@ -0,0 +1,110 @@
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate with the given common name and its key.
+func writeCertificate(t *testing.T, dir, commonName string, modTime time.Time) (certFile, keyFile string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(certFile, modTime, modTime)
+	os.Chtimes(keyFile, modTime, modTime)
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, c *Certificate) string {
+	cert, err := c.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestWatchReloadsCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certificate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCertificate(t, dir, "first", time.Now().Add(-time.Minute))
+	cert := New(certFile, keyFile)
+	if _, err := cert.GetCertificate(nil); err == nil {
+		t.Fatal("expected an error before the certificate is loaded")
+	}
+	if err := cert.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if name := commonName(t, cert); name != "first" {
+		t.Fatalf("expected the first certificate, got %s", name)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	errs := make(chan error, 10)
+	go cert.Watch(5*time.Millisecond, stop, func(err error) { errs <- err })
+
+	writeCertificate(t, dir, "renewed", time.Now())
+	deadline := time.Now().Add(2 * time.Second)
+	for commonName(t, cert) != "renewed" {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the renewed certificate to be loaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// a broken certificate is rejected and the current one stays in use
+	if err := ioutil.WriteFile(certFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	select {
+	case <-errs:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a reload error")
+	}
+	if name := commonName(t, cert); name != "renewed" {
+		t.Fatalf("expected the renewed certificate to stay in use, got %s", name)
+	}
+}
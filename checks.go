@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Microkubes/microservice-registration/config"
+	"github.com/Microkubes/microservice-registration/readiness"
+	"github.com/Microkubes/microservice-registration/signer"
+)
+
+// Names of the readiness checks.
+const (
+	CheckAMQP        = "amqp"
+	CheckUserService = "user-microservice"
+	CheckUserProfile = "microservice-user-profile"
+	CheckSystemKey   = "system-key"
+)
+
+// NewReadinessChecker returns a readiness.Checker with the checks of the dependencies of
+// the registration: RabbitMQ, the user and user profile microservices and the system key.
+func NewReadinessChecker(store *config.Store, amqpFactory AmqpChannelFactory, client *http.Client, sign *signer.Signer) *readiness.Checker {
+	cfg := store.Get()
+	checker := readiness.NewChecker(cfg.Readiness.CacheTTL())
+
+	checker.Register(CheckAMQP, cfg.Readiness.Timeout(CheckAMQP), func(ctx context.Context) error {
+		conn, _, err := amqpFactory(store.Get())
+		if err != nil {
+			return err
+		}
+		if conn == nil {
+			return nil
+		}
+		return conn.Close()
+	})
+	checker.Register(CheckUserService, cfg.Readiness.Timeout(CheckUserService), readiness.HTTPCheck(client, func() string {
+		return store.Get().Services.UserMicroservice.URL
+	}))
+	checker.Register(CheckUserProfile, cfg.Readiness.Timeout(CheckUserProfile), readiness.HTTPCheck(client, func() string {
+		return store.Get().Services.UserProfile.URL
+	}))
+	checker.Register(CheckSystemKey, cfg.Readiness.Timeout(CheckSystemKey), func(ctx context.Context) error {
+		if !sign.Loaded() {
+			return errors.New("the system key is not loaded")
+		}
+		return nil
+	})
+	return checker
+}
@@ -0,0 +1,47 @@
+// Code generated by goagen v1.3.1, DO NOT EDIT.
+//
+// API "user": jwks Resource Client
+//
+// Command:
+// $ goagen
+// --design=github.com/Microkubes/microservice-registration/design
+// --out=$(GOPATH)src/github.com/Microkubes/microservice-registration
+// --version=v1.3.1
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// JwksJwksPath computes a request path to the jwks action of jwks.
+func JwksJwksPath() string {
+
+	return fmt.Sprintf("/.well-known/jwks.json")
+}
+
+// Publishes the public keys for verifying the self-signed system tokens
+func (c *Client) JwksJwks(ctx context.Context, path string) (*http.Response, error) {
+	req, err := c.NewJwksJwksRequest(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return c.Client.Do(ctx, req)
+}
+
+// NewJwksJwksRequest create the request corresponding to the jwks action endpoint of the jwks resource.
+func (c *Client) NewJwksJwksRequest(ctx context.Context, path string) (*http.Request, error) {
+	scheme := c.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	u := url.URL{Host: c.Host, Scheme: scheme, Path: path}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
@@ -16,8 +16,39 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 )
 
+// ConfirmVerificationUserPath computes a request path to the confirmVerification action of user.
+func ConfirmVerificationUserPath(id string) string {
+	param0 := id
+
+	return fmt.Sprintf("/users/register/%s/verified", param0)
+}
+
+// Moves a registration to verified once the user microservice reports the user as active
+func (c *Client) ConfirmVerificationUser(ctx context.Context, path string) (*http.Response, error) {
+	req, err := c.NewConfirmVerificationUserRequest(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return c.Client.Do(ctx, req)
+}
+
+// NewConfirmVerificationUserRequest create the request corresponding to the confirmVerification action endpoint of the user resource.
+func (c *Client) NewConfirmVerificationUserRequest(ctx context.Context, path string) (*http.Request, error) {
+	scheme := c.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	u := url.URL{Host: c.Host, Scheme: scheme, Path: path}
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
 // RegisterUserPath computes a request path to the register action of user.
 func RegisterUserPath() string {
 
@@ -25,8 +56,8 @@ func RegisterUserPath() string {
 }
 
 // Creates user
-func (c *Client) RegisterUser(ctx context.Context, path string, payload *UserPayload, contentType string) (*http.Response, error) {
-	req, err := c.NewRegisterUserRequest(ctx, path, payload, contentType)
+func (c *Client) RegisterUser(ctx context.Context, path string, payload *UserPayload, async *bool, contentType string) (*http.Response, error) {
+	req, err := c.NewRegisterUserRequest(ctx, path, payload, async, contentType)
 	if err != nil {
 		return nil, err
 	}
@@ -34,7 +65,7 @@ func (c *Client) RegisterUser(ctx context.Context, path string, payload *UserPay
 }
 
 // NewRegisterUserRequest create the request corresponding to the register action endpoint of the user resource.
-func (c *Client) NewRegisterUserRequest(ctx context.Context, path string, payload *UserPayload, contentType string) (*http.Request, error) {
+func (c *Client) NewRegisterUserRequest(ctx context.Context, path string, payload *UserPayload, async *bool, contentType string) (*http.Request, error) {
 	var body bytes.Buffer
 	if contentType == "" {
 		contentType = "*/*" // Use default encoder
@@ -48,6 +79,12 @@ func (c *Client) NewRegisterUserRequest(ctx context.Context, path string, payloa
 		scheme = "http"
 	}
 	u := url.URL{Host: c.Host, Scheme: scheme, Path: path}
+	values := u.Query()
+	if async != nil {
+		tmp7 := strconv.FormatBool(*async)
+		values.Set("async", tmp7)
+	}
+	u.RawQuery = values.Encode()
 	req, err := http.NewRequest("POST", u.String(), &body)
 	if err != nil {
 		return nil, err
@@ -61,6 +98,36 @@ func (c *Client) NewRegisterUserRequest(ctx context.Context, path string, payloa
 	return req, nil
 }
 
+// RegistrationStatusUserPath computes a request path to the registrationStatus action of user.
+func RegistrationStatusUserPath(id string) string {
+	param0 := id
+
+	return fmt.Sprintf("/users/register/%s/status", param0)
+}
+
+// Returns where a registration is in its lifecycle
+func (c *Client) RegistrationStatusUser(ctx context.Context, path string) (*http.Response, error) {
+	req, err := c.NewRegistrationStatusUserRequest(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return c.Client.Do(ctx, req)
+}
+
+// NewRegistrationStatusUserRequest create the request corresponding to the registrationStatus action endpoint of the user resource.
+func (c *Client) NewRegistrationStatusUserRequest(ctx context.Context, path string) (*http.Request, error) {
+	scheme := c.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	u := url.URL{Host: c.Host, Scheme: scheme, Path: path}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
 // ResendVerificationUserPath computes a request path to the resendVerification action of user.
 func ResendVerificationUserPath() string {
 
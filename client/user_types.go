@@ -12,9 +12,65 @@ package client
 
 import (
 	"github.com/keitaroinc/goa"
+	"time"
 	"unicode/utf8"
 )
 
+// A state change of a registration
+type registrationTransition struct {
+	// When the registration moved to the state
+	At *time.Time `form:"at,omitempty" json:"at,omitempty" yaml:"at,omitempty" xml:"at,omitempty"`
+	// The error that failed the registration
+	Error *string `form:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty" xml:"error,omitempty"`
+	// The state the registration moved to
+	State *string `form:"state,omitempty" json:"state,omitempty" yaml:"state,omitempty" xml:"state,omitempty"`
+}
+
+// Validate validates the registrationTransition type instance.
+func (ut *registrationTransition) Validate() (err error) {
+	if ut.State == nil {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`request`, "state"))
+	}
+	if ut.At == nil {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`request`, "at"))
+	}
+	return
+}
+
+// Publicize creates RegistrationTransition from registrationTransition
+func (ut *registrationTransition) Publicize() *RegistrationTransition {
+	var pub RegistrationTransition
+	if ut.At != nil {
+		pub.At = *ut.At
+	}
+	if ut.Error != nil {
+		pub.Error = ut.Error
+	}
+	if ut.State != nil {
+		pub.State = *ut.State
+	}
+	return &pub
+}
+
+// A state change of a registration
+type RegistrationTransition struct {
+	// When the registration moved to the state
+	At time.Time `form:"at" json:"at" yaml:"at" xml:"at"`
+	// The error that failed the registration
+	Error *string `form:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty" xml:"error,omitempty"`
+	// The state the registration moved to
+	State string `form:"state" json:"state" yaml:"state" xml:"state"`
+}
+
+// Validate validates the RegistrationTransition type instance.
+func (ut *RegistrationTransition) Validate() (err error) {
+	if ut.State == "" {
+		err = goa.MergeErrors(err, goa.MissingAttributeError(`type`, "state"))
+	}
+
+	return
+}
+
 // Payload for resending email verification. Contains user email
 type resendVerificationPayload struct {
 	// User email for verification
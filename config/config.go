@@ -2,7 +2,14 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Microkubes/microservice-tools/gateway"
 
@@ -27,31 +34,905 @@ type Config struct {
 	// SystemKey holds the path to the system key which is provate RSA key
 	SystemKey string `json:"systemKey"`
 
-	// Services is a map of <service-name>:<service base URL>. For example,w
-	// "user-microservice": "http://kong.gateway:8001/user"
-	Services map[string]string `json:"services"`
+	// PreviousSystemKeys holds the paths to the previous system keys (private or public)
+	// that are still published in the JWKS during a key rotation.
+	PreviousSystemKeys []string `json:"previousSystemKeys,omitempty"`
 
-	// Mail is a map of <property>:<value>. For example,
-	// "host": "smtp.example.com"
-	Mail map[string]string `json:"mail"`
+	// Services holds the downstream service endpoints. A service is either the service base
+	// URL or an object with the URL, timeout and authentication. For example,
+	// "user-microservice": "http://kong.gateway:8001/user" or
+	// "user-microservice": {"url": "http://kong.gateway:8001/user", "token": {"audience": "user"}}
+	Services ServicesConfig `json:"services"`
+
+	// Mail holds the SMTP settings
+	Mail MailConfig `json:"mail"`
 
 	// RabbitMQ holds information about the rabbitmq server
-	RabbitMQ map[string]string `json:"rabbitmq"`
+	RabbitMQ RabbitMQConfig `json:"rabbitmq"`
+
+	// Messaging holds the routing of the email messages
+	Messaging MessagingConfig `json:"messaging,omitempty"`
 
 	//Version is version of the service
 	Version string `json:"version"`
+
+	// Retry holds the retry policies for the calls to the downstream services
+	Retry *RetryConfig `json:"retry,omitempty"`
+
+	// Resilience holds the circuit breaker configuration
+	Resilience *ResilienceConfig `json:"resilience,omitempty"`
+
+	// Admin holds the configuration of the admin listener
+	Admin *AdminConfig `json:"admin,omitempty"`
+
+	// HTTPClient holds the configuration of the HTTP client used for the calls to the downstream services
+	HTTPClient *HTTPClientConfig `json:"http,omitempty"`
+
+	// Shutdown holds the graceful shutdown settings
+	Shutdown *ShutdownConfig `json:"shutdown,omitempty"`
+
+	// Gateway holds the API Gateway self-registration settings
+	Gateway *GatewayConfig `json:"gateway,omitempty"`
+
+	// Server holds the listen address and TLS settings of the service listener
+	Server *ServerConfig `json:"server,omitempty"`
+
+	// Tracing holds the OpenTelemetry tracing settings
+	Tracing *TracingConfig `json:"tracing,omitempty"`
+
+	// Logging holds the log level and redaction settings
+	Logging *LoggingConfig `json:"logging,omitempty"`
+
+	// Audit holds the security audit log settings
+	Audit *AuditConfig `json:"audit,omitempty"`
+
+	// Readiness holds the timeouts and the caching of the readiness checks
+	Readiness *ReadinessConfig `json:"readiness,omitempty"`
+
+	// Async holds the settings of the asynchronous registrations
+	Async *AsyncConfig `json:"async,omitempty"`
+}
+
+// Defaults of the asynchronous registrations.
+const (
+	DefaultAsyncWorkers     = 4
+	DefaultAsyncQueueSize   = 100
+	DefaultAsyncMaxAttempts = 5
+	DefaultAsyncBackoff     = time.Second
+	DefaultAsyncMaxBackoff  = time.Minute
+)
+
+// AsyncConfig holds the settings of the asynchronous registrations, processed by a pool of
+// workers after the request was accepted.
+type AsyncConfig struct {
+	// Enabled processes the registrations asynchronously unless a request asks otherwise.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Workers is the number of registrations processed concurrently. Defaults to 4.
+	Workers int `json:"workers,omitempty"`
+
+	// QueueSize is how many accepted registrations can wait for a worker. Defaults to 100.
+	QueueSize int `json:"queueSize,omitempty"`
+
+	// MaxAttempts is how many times a failed registration step is attempted. Defaults to 5.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+
+	// BackoffMs is the delay before the first retry of a step. Defaults to 1000.
+	BackoffMs int `json:"backoffMs,omitempty"`
+
+	// MaxBackoffMs caps the delay between the retries. Defaults to 60000.
+	MaxBackoffMs int `json:"maxBackoffMs,omitempty"`
+
+	// OrphanAfterMs is how long a registration that is still being processed must not have
+	// changed to be failed at startup, as its payload was lost with the process. Defaults
+	// to 0, which fails all of them: set it above the longest registration when several
+	// instances share the database.
+	OrphanAfterMs int `json:"orphanAfterMs,omitempty"`
+}
+
+// IsEnabled reports whether the registrations are asynchronous by default.
+func (a *AsyncConfig) IsEnabled() bool {
+	return a != nil && a.Enabled
+}
+
+// WorkerCount returns the number of workers.
+func (a *AsyncConfig) WorkerCount() int {
+	if a == nil || a.Workers == 0 {
+		return DefaultAsyncWorkers
+	}
+	return a.Workers
+}
+
+// Capacity returns the size of the queue of accepted registrations.
+func (a *AsyncConfig) Capacity() int {
+	if a == nil || a.QueueSize == 0 {
+		return DefaultAsyncQueueSize
+	}
+	return a.QueueSize
+}
+
+// Attempts returns how many times a failed step is attempted.
+func (a *AsyncConfig) Attempts() int {
+	if a == nil || a.MaxAttempts == 0 {
+		return DefaultAsyncMaxAttempts
+	}
+	return a.MaxAttempts
+}
+
+// Backoff returns the delay before the first retry and the maximal delay between retries.
+func (a *AsyncConfig) Backoff() (initial, max time.Duration) {
+	initial, max = DefaultAsyncBackoff, DefaultAsyncMaxBackoff
+	if a != nil && a.BackoffMs > 0 {
+		initial = time.Duration(a.BackoffMs) * time.Millisecond
+	}
+	if a != nil && a.MaxBackoffMs > 0 {
+		max = time.Duration(a.MaxBackoffMs) * time.Millisecond
+	}
+	return initial, max
+}
+
+// OrphanAge returns how long a registration being processed must not have changed to be
+// failed at startup.
+func (a *AsyncConfig) OrphanAge() time.Duration {
+	if a == nil {
+		return 0
+	}
+	return time.Duration(a.OrphanAfterMs) * time.Millisecond
+}
+
+// Databases of the registration records, set as database.dbName.
+const (
+	// DatabaseMemory keeps the registration records in memory. The records are lost on
+	// restart.
+	DatabaseMemory = "memory"
+
+	// DatabaseMongo stores the registration records in MongoDB.
+	DatabaseMongo = "mongodb"
+)
+
+// Defaults of the readiness checks.
+const (
+	DefaultReadinessTimeout = 2 * time.Second
+	DefaultReadinessCache   = 5 * time.Second
+)
+
+// ReadinessConfig holds the timeouts and the caching of the readiness checks.
+type ReadinessConfig struct {
+	// TimeoutMs is the timeout of a check. Defaults to 2000.
+	TimeoutMs int `json:"timeoutMs,omitempty"`
+
+	// CacheMs is how long the result of a check is reused. Defaults to 5000.
+	CacheMs int `json:"cacheMs,omitempty"`
+
+	// Checks holds the timeouts of the individual checks, by check name.
+	Checks map[string]ReadinessCheckConfig `json:"checks,omitempty"`
+}
+
+// ReadinessCheckConfig holds the settings of a readiness check.
+type ReadinessCheckConfig struct {
+	// TimeoutMs is the timeout of the check. Defaults to the readiness timeoutMs.
+	TimeoutMs int `json:"timeoutMs,omitempty"`
+}
+
+// Timeout returns the timeout of the named check.
+func (r *ReadinessConfig) Timeout(check string) time.Duration {
+	if r == nil {
+		return DefaultReadinessTimeout
+	}
+	if c, ok := r.Checks[check]; ok && c.TimeoutMs > 0 {
+		return time.Duration(c.TimeoutMs) * time.Millisecond
+	}
+	if r.TimeoutMs > 0 {
+		return time.Duration(r.TimeoutMs) * time.Millisecond
+	}
+	return DefaultReadinessTimeout
+}
+
+// CacheTTL returns how long the result of a check is reused.
+func (r *ReadinessConfig) CacheTTL() time.Duration {
+	if r == nil || r.CacheMs == 0 {
+		return DefaultReadinessCache
+	}
+	return time.Duration(r.CacheMs) * time.Millisecond
+}
+
+// Audit log sinks.
+const (
+	// AuditNone disables the audit log.
+	AuditNone = "none"
+
+	// AuditFile appends the audit entries to a file, rotated by size.
+	AuditFile = "file"
+
+	// AuditSyslog sends the audit entries to syslog.
+	AuditSyslog = "syslog"
+
+	// AuditAMQP publishes the audit entries to a RabbitMQ queue.
+	AuditAMQP = "amqp"
+)
+
+// AuditConfig holds the security audit log settings.
+type AuditConfig struct {
+	// Sink is "none" (default), "file", "syslog" or "amqp".
+	Sink string `json:"sink,omitempty"`
+
+	// File is the audit log file of the file sink.
+	File string `json:"file,omitempty"`
+
+	// MaxSizeMB is the size at which the audit log file is rotated. Defaults to 100.
+	MaxSizeMB int `json:"maxSizeMB,omitempty"`
+
+	// MaxBackups is the number of rotated audit log files kept. Defaults to 10.
+	MaxBackups int `json:"maxBackups,omitempty"`
+
+	// SyslogNetwork and SyslogAddress select the syslog server, for example "udp" and
+	// "syslog:514". The local syslog daemon is used when not set.
+	SyslogNetwork string `json:"syslogNetwork,omitempty"`
+	SyslogAddress string `json:"syslogAddress,omitempty"`
+
+	// SyslogTag is the syslog tag of the entries. Defaults to "microservice-registration".
+	SyslogTag string `json:"syslogTag,omitempty"`
+
+	// Queue is the RabbitMQ queue of the amqp sink. Defaults to "audit-log".
+	Queue string `json:"queue,omitempty"`
+}
+
+// SinkType returns the configured sink, AuditNone when not set.
+func (a *AuditConfig) SinkType() string {
+	if a == nil || a.Sink == "" {
+		return AuditNone
+	}
+	return a.Sink
+}
+
+// LoggingConfig holds the log level and redaction settings.
+type LoggingConfig struct {
+	// Level is "debug", "info" (default), "warn" or "error".
+	Level string `json:"level,omitempty"`
+
+	// RedactKeys are the names of the additional fields whose values are always redacted.
+	RedactKeys []string `json:"redactKeys,omitempty"`
+
+	// DisableRedaction logs the emails, tokens and passwords as they are. Meant for local
+	// development only.
+	DisableRedaction bool `json:"disableRedaction,omitempty"`
+}
+
+// LogLevel returns the configured log level, "info" when not set.
+func (l *LoggingConfig) LogLevel() string {
+	if l == nil || l.Level == "" {
+		return "info"
+	}
+	return l.Level
+}
+
+// Trace exporters.
+const (
+	// TracingNone disables the tracing.
+	TracingNone = "none"
+
+	// TracingOTLP exports the spans to an OpenTelemetry collector over OTLP/HTTP.
+	TracingOTLP = "otlp"
+
+	// TracingStdout writes the spans as JSON to stdout.
+	TracingStdout = "stdout"
+
+	// TracingFile writes the spans as JSON to a file.
+	TracingFile = "file"
+)
+
+// TracingConfig holds the OpenTelemetry tracing settings.
+type TracingConfig struct {
+	// Exporter is "none" (default), "otlp", "stdout" or "file".
+	Exporter string `json:"exporter,omitempty"`
+
+	// Endpoint is the host:port of the OTLP/HTTP collector. Defaults to "localhost:4318".
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Insecure sends the spans to the collector over plain HTTP.
+	Insecure bool `json:"insecure,omitempty"`
+
+	// File is the file the spans are appended to with the file exporter.
+	File string `json:"file,omitempty"`
+
+	// SampleRatio is the fraction (0-1) of the traces that are sampled. Defaults to 1.
+	// Requests that carry a sampled trace context are always sampled.
+	SampleRatio *float64 `json:"sampleRatio,omitempty"`
+}
+
+// ExporterType returns the configured exporter, TracingNone when not set.
+func (t *TracingConfig) ExporterType() string {
+	if t == nil || t.Exporter == "" {
+		return TracingNone
+	}
+	return t.Exporter
+}
+
+// ServerConfig holds the listen address and TLS settings of the service listener.
+type ServerConfig struct {
+	// Address is the listen address, for example "127.0.0.1:8080". Defaults to all
+	// interfaces on the microservice port.
+	Address string `json:"address,omitempty"`
+
+	// TLS enables HTTPS.
+	TLS *ServerTLSConfig `json:"tls,omitempty"`
+}
+
+// ServerTLSConfig holds the certificate of the service listener. The files are reloaded
+// when they change.
+type ServerTLSConfig struct {
+	// CertFile is the PEM encoded certificate (chain).
+	CertFile string `json:"certFile,omitempty"`
+
+	// KeyFile is the PEM encoded private key of the certificate.
+	KeyFile string `json:"keyFile,omitempty"`
+}
+
+// ListenAddress returns the listen address of the service listener.
+func (c *Config) ListenAddress() string {
+	if c.Server != nil && c.Server.Address != "" {
+		return c.Server.Address
+	}
+	return fmt.Sprintf(":%d", c.Microservice.MicroservicePort)
+}
+
+// API Gateway registrars.
+const (
+	// RegistrarKong registers the service on Kong, through GatewayAdminURL.
+	RegistrarKong = "kong"
+
+	// RegistrarStatic writes the service registration to a file, for gateways configured from files.
+	RegistrarStatic = "static"
+
+	// RegistrarNone disables the self-registration.
+	RegistrarNone = "none"
+)
+
+// GatewayConfig holds the API Gateway self-registration settings.
+type GatewayConfig struct {
+	// Registrar is "kong" (default), "static" or "none".
+	Registrar string `json:"registrar,omitempty"`
+
+	// StaticFile is the file the static registrar writes the registration to.
+	StaticFile string `json:"staticFile,omitempty"`
+
+	// InitialBackoffMs is the delay before the first retry of a failed registration. Defaults to 1000.
+	InitialBackoffMs int `json:"initialBackoffMs,omitempty"`
+
+	// MaxBackoffMs caps the delay between two registration attempts. Defaults to 60000.
+	MaxBackoffMs int `json:"maxBackoffMs,omitempty"`
+
+	// AttemptTimeoutMs is the timeout of a registration attempt. Defaults to 10000.
+	AttemptTimeoutMs int `json:"attemptTimeoutMs,omitempty"`
+}
+
+// DefaultRegistrationAttemptTimeout is the timeout of a registration attempt when not configured.
+const DefaultRegistrationAttemptTimeout = 10 * time.Second
+
+// AttemptTimeout returns the timeout of a registration attempt.
+func (g *GatewayConfig) AttemptTimeout() time.Duration {
+	if g == nil || g.AttemptTimeoutMs <= 0 {
+		return DefaultRegistrationAttemptTimeout
+	}
+	return time.Duration(g.AttemptTimeoutMs) * time.Millisecond
+}
+
+// RegistrarType returns the configured registrar, RegistrarKong when not set.
+func (g *GatewayConfig) RegistrarType() string {
+	if g == nil || g.Registrar == "" {
+		return RegistrarKong
+	}
+	return g.Registrar
+}
+
+// DefaultShutdownGracePeriod is how long the in-flight requests are waited for on shutdown
+// when no grace period is configured.
+const DefaultShutdownGracePeriod = 30 * time.Second
+
+// ShutdownConfig holds the graceful shutdown settings.
+type ShutdownConfig struct {
+	// GracePeriodMs is how long the in-flight requests are waited for after the service
+	// stopped accepting new ones.
+	GracePeriodMs int `json:"gracePeriodMs,omitempty"`
+}
+
+// GracePeriod returns the configured grace period, or DefaultShutdownGracePeriod.
+func (s *ShutdownConfig) GracePeriod() time.Duration {
+	if s == nil || s.GracePeriodMs == 0 {
+		return DefaultShutdownGracePeriod
+	}
+	return time.Duration(s.GracePeriodMs) * time.Millisecond
+}
+
+// HTTPClientConfig holds the TLS, connection pool and proxy settings of the outbound HTTP client.
+type HTTPClientConfig struct {
+	// CAFiles is a list of PEM encoded CA bundles trusted in addition to the system roots.
+	CAFiles []string `json:"caFiles,omitempty"`
+
+	// CertFile is the PEM encoded client certificate for mutual TLS.
+	CertFile string `json:"certFile,omitempty"`
+
+	// KeyFile is the PEM encoded private key of the client certificate.
+	KeyFile string `json:"keyFile,omitempty"`
+
+	// MinTLSVersion is the minimal TLS version: "1.0", "1.1", "1.2" (default) or "1.3".
+	MinTLSVersion string `json:"minTlsVersion,omitempty"`
+
+	// MaxIdleConns is the maximal number of idle connections across all hosts.
+	MaxIdleConns int `json:"maxIdleConns,omitempty"`
+
+	// MaxIdleConnsPerHost is the maximal number of idle connections per host.
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost,omitempty"`
+
+	// MaxConnsPerHost limits the number of connections per host. Zero means no limit.
+	MaxConnsPerHost int `json:"maxConnsPerHost,omitempty"`
+
+	// IdleConnTimeoutMs is how long an idle connection is kept in the pool, in milliseconds.
+	IdleConnTimeoutMs int `json:"idleConnTimeoutMs,omitempty"`
+
+	// TimeoutMs is the overall timeout of a request, in milliseconds. Zero means no timeout.
+	TimeoutMs int `json:"timeoutMs,omitempty"`
+
+	// Proxy holds the proxy settings. The HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+	// variables are used for the settings that are not set.
+	Proxy *ProxyConfig `json:"proxy,omitempty"`
+}
+
+// ProxyConfig holds the proxy settings of the outbound HTTP client.
+type ProxyConfig struct {
+	// HTTPProxy is the proxy URL for plain HTTP requests.
+	HTTPProxy string `json:"httpProxy,omitempty"`
+
+	// HTTPSProxy is the proxy URL for HTTPS requests.
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+
+	// NoProxy is a comma separated list of hosts (and domain suffixes) that are not proxied.
+	NoProxy string `json:"noProxy,omitempty"`
+}
+
+// AdminConfig holds the configuration of the admin listener. The admin listener serves
+// the operational endpoints and is not registered on the API Gateway.
+type AdminConfig struct {
+	// Address is the listen address of the admin listener, for example ":8090".
+	Address string `json:"address,omitempty"`
+}
+
+// ResilienceConfig holds the circuit breaker (hystrix) configuration.
+type ResilienceConfig struct {
+	// Commands is a map of <hystrix command name>:<command settings>. For example,
+	// "user-microservice.create_user": {"timeout": 90000}
+	Commands map[string]CommandConfig `json:"commands,omitempty"`
+}
+
+// CommandConfig holds the circuit breaker settings for one hystrix command.
+// Zero values fall back to the service defaults for the command.
+type CommandConfig struct {
+	// Timeout is how long to wait for the command to complete, in milliseconds.
+	Timeout int `json:"timeout,omitempty"`
+
+	// MaxConcurrentRequests is how many commands of the same type can run at the same time.
+	// It is fixed once the command first runs.
+	MaxConcurrentRequests int `json:"maxConcurrentRequests,omitempty"`
+
+	// ErrorPercentThreshold opens the circuit once the rolling error percentage exceeds it.
+	ErrorPercentThreshold int `json:"errorPercentThreshold,omitempty"`
+
+	// SleepWindow is how long, in milliseconds, to wait after the circuit opens before testing for recovery.
+	SleepWindow int `json:"sleepWindow,omitempty"`
+
+	// RequestVolumeThreshold is the minimum number of requests needed before the circuit can trip.
+	RequestVolumeThreshold int `json:"requestVolumeThreshold,omitempty"`
+}
+
+// RabbitMQConfig holds the connection settings of the RabbitMQ server.
+type RabbitMQConfig struct {
+	// Username is the RabbitMQ user.
+	Username string `json:"username"`
+
+	// Password is the password of the RabbitMQ user.
+	Password string `json:"password"`
+
+	// Host is the RabbitMQ host name.
+	Host string `json:"host"`
+
+	// Port is the AMQP port. It is also accepted as a string, as in the older configuration files.
+	Port int `json:"port"`
+
+	// VHost is the virtual host. The default virtual host "/" is used when empty.
+	VHost string `json:"vhost,omitempty"`
+
+	// TLS enables AMQPS with the given settings.
+	TLS *TLSConfig `json:"tls,omitempty"`
+
+	// HeartbeatMs is the heartbeat interval in milliseconds. The default is 10 seconds.
+	HeartbeatMs int `json:"heartbeatMs,omitempty"`
+
+	// unknown holds the properties that are not recognized, reported by Validate
+	unknown []string
+}
+
+// UnmarshalJSON decodes a RabbitMQConfig, accepting the port as a number or a string.
+func (r *RabbitMQConfig) UnmarshalJSON(data []byte) error {
+	type plain RabbitMQConfig
+	aux := struct {
+		*plain
+		Port flexInt `json:"port"`
+	}{plain: (*plain)(r), Port: flexInt(r.Port)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	r.Port = int(aux.Port)
+	unknown, err := unknownProperties(data, r)
+	r.unknown = unknown
+	return err
+}
+
+// TLSConfig holds client TLS settings.
+type TLSConfig struct {
+	// CAFile is a PEM encoded CA bundle trusted in addition to the system roots.
+	CAFile string `json:"caFile,omitempty"`
+
+	// CertFile is the PEM encoded client certificate.
+	CertFile string `json:"certFile,omitempty"`
+
+	// KeyFile is the PEM encoded private key of the client certificate.
+	KeyFile string `json:"keyFile,omitempty"`
+
+	// ServerName overrides the server name used to verify the server certificate.
+	ServerName string `json:"serverName,omitempty"`
+}
+
+// Message kinds.
+const (
+	// MessageVerification is the verification email sent on registration.
+	MessageVerification = "verification"
+
+	// MessageResend is the verification email sent again on request.
+	MessageResend = "resend"
+
+	// MessageWelcome is the welcome email.
+	MessageWelcome = "welcome"
+
+	// MessageInvite is the invitation email.
+	MessageInvite = "invite"
+)
+
+// DefaultRoutes returns the routes used for the message kinds that are not configured.
+// The messages go to the "email-queue" queue of the mail microservice, except the resent
+// verification emails, which go to the "verification-email" queue as they always did. To
+// send every kind to one queue, configure the "resend" route with {"queue": "email-queue"}.
+func DefaultRoutes() map[string]RouteConfig {
+	return map[string]RouteConfig{
+		MessageVerification: {Queue: "email-queue", Template: "userVerification"},
+		MessageResend:       {Queue: "verification-email", Template: "userVerification"},
+		MessageWelcome:      {Queue: "email-queue", Template: "userWelcome"},
+		MessageInvite:       {Queue: "email-queue", Template: "userInvitation"},
+	}
+}
+
+// MessagingConfig holds the routing of the messages published to RabbitMQ.
+type MessagingConfig struct {
+	// DeclareQueues declares the exchanges and queues of all routes, and binds them, at startup.
+	DeclareQueues bool `json:"declareQueues,omitempty"`
+
+	// Routes is a map of <message kind>:<route>. The message kinds are "verification",
+	// "resend", "welcome" and "invite". Empty route properties fall back to the defaults.
+	Routes map[string]RouteConfig `json:"routes,omitempty"`
+}
+
+// RouteConfig holds where a message kind is published and the mail template it is rendered with.
+type RouteConfig struct {
+	// Exchange is the exchange the message is published to. The default exchange is used
+	// when empty, which delivers the message to Queue.
+	Exchange string `json:"exchange,omitempty"`
+
+	// ExchangeType is the type of the exchange, declared when DeclareQueues is set. Defaults to "direct".
+	ExchangeType string `json:"exchangeType,omitempty"`
+
+	// RoutingKey is the routing key of the message. Defaults to Queue.
+	RoutingKey string `json:"routingKey,omitempty"`
+
+	// Queue is the queue the message ends up in.
+	Queue string `json:"queue,omitempty"`
+
+	// Template is the name of the mail template.
+	Template string `json:"template,omitempty"`
+}
+
+// Route returns the route of a message kind, with the defaults applied.
+func (m MessagingConfig) Route(kind string) RouteConfig {
+	route := DefaultRoutes()[kind]
+	configured := m.Routes[kind]
+	if configured.Exchange != "" {
+		route.Exchange = configured.Exchange
+	}
+	if configured.ExchangeType != "" {
+		route.ExchangeType = configured.ExchangeType
+	}
+	if configured.RoutingKey != "" {
+		route.RoutingKey = configured.RoutingKey
+	}
+	if configured.Queue != "" {
+		route.Queue = configured.Queue
+	}
+	if configured.Template != "" {
+		route.Template = configured.Template
+	}
+	if route.ExchangeType == "" {
+		route.ExchangeType = "direct"
+	}
+	if route.RoutingKey == "" {
+		route.RoutingKey = route.Queue
+	}
+	return route
+}
+
+// MailConfig holds the SMTP settings.
+type MailConfig struct {
+	// Host is the SMTP host name.
+	Host string `json:"host"`
+
+	// Port is the SMTP port. It is also accepted as a string, as in the older configuration files.
+	Port int `json:"port"`
+
+	// User is the SMTP user.
+	User string `json:"user"`
+
+	// Password is the password of the SMTP user.
+	Password string `json:"password"`
+
+	// Email is the sender address.
+	Email string `json:"email,omitempty"`
+
+	// unknown holds the properties that are not recognized, reported by Validate
+	unknown []string
+}
+
+// UnmarshalJSON decodes a MailConfig, accepting the port as a number or a string.
+func (m *MailConfig) UnmarshalJSON(data []byte) error {
+	type plain MailConfig
+	aux := struct {
+		*plain
+		Port flexInt `json:"port"`
+	}{plain: (*plain)(m), Port: flexInt(m.Port)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	m.Port = int(aux.Port)
+	unknown, err := unknownProperties(data, m)
+	m.unknown = unknown
+	return err
+}
+
+// ServicesConfig holds the downstream service endpoints.
+type ServicesConfig struct {
+	// UserMicroservice is the user microservice.
+	UserMicroservice ServiceConfig `json:"user-microservice"`
+
+	// UserProfile is the user profile microservice.
+	UserProfile ServiceConfig `json:"microservice-user-profile"`
+}
+
+// Authentication types of a downstream service.
+const (
+	// AuthSystemToken authenticates with a self-signed system JWT. This is the default.
+	AuthSystemToken = "system-token"
+
+	// AuthBasic authenticates with HTTP basic authentication.
+	AuthBasic = "basic"
+
+	// AuthNone sends no credentials.
+	AuthNone = "none"
+)
+
+// ServiceConfig holds the configuration of a downstream service.
+type ServiceConfig struct {
+	// URL is the base URL of the service.
+	URL string `json:"url"`
+
+	// TimeoutMs is the timeout of a request to the service in milliseconds. The timeout of
+	// the HTTP client is used when zero.
+	TimeoutMs int `json:"timeoutMs,omitempty"`
+
+	// Auth selects how the requests to the service are authenticated.
+	Auth *AuthConfig `json:"auth,omitempty"`
+
+	// Token holds the claims of the system token sent to the service.
+	Token *TokenConfig `json:"token,omitempty"`
+}
+
+// AuthConfig holds the authentication of the requests to a downstream service.
+type AuthConfig struct {
+	// Type is "system-token" (default), "basic" or "none".
+	Type string `json:"type,omitempty"`
+
+	// Username is the user for basic authentication.
+	Username string `json:"username,omitempty"`
+
+	// Password is the password for basic authentication.
+	Password string `json:"password,omitempty"`
+}
+
+// AuthType returns the authentication type of the service.
+func (s ServiceConfig) AuthType() string {
+	if s.Auth == nil || s.Auth.Type == "" {
+		return AuthSystemToken
+	}
+	return s.Auth.Type
+}
+
+// UnmarshalJSON decodes a ServiceConfig from either a plain URL string or an object.
+func (s *ServiceConfig) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		*s = ServiceConfig{URL: url}
+		return nil
+	}
+	type plain ServiceConfig
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+// TokenConfig holds the claims of the self-signed system token. Empty values fall back
+// to the defaults: issuer "microservice-registration", scope "api:read" and role "system".
+type TokenConfig struct {
+	// Issuer is the "iss" and "sub" claim.
+	Issuer string `json:"issuer,omitempty"`
+
+	// Audience is the "aud" claim.
+	Audience string `json:"audience,omitempty"`
+
+	// Scope is the "scope" claim.
+	Scope string `json:"scope,omitempty"`
+
+	// Roles is the list of roles of the system user.
+	Roles []string `json:"roles,omitempty"`
 }
 
-// LoadConfig loads a Config from a configuration JSON file.
-func LoadConfig(confFile string) (*Config, error) {
-	confBytes, err := ioutil.ReadFile(confFile)
-	if err != nil {
+// RetryConfig holds the retry configuration for the idempotent downstream calls.
+type RetryConfig struct {
+	// Default is the retry policy used for every call kind that is not overridden in Calls.
+	Default RetryPolicyConfig `json:"default"`
+
+	// Calls is a map of <call kind>:<policy override>. The call kinds are
+	// "create_user", "update_user_profile", "get_user_profile", "get_user", "delete_user" and
+	// "delete_user_profile".
+	Calls map[string]RetryPolicyConfig `json:"calls,omitempty"`
+
+	// Budget limits the retries across all calls.
+	Budget RetryBudgetConfig `json:"budget"`
+
+	// IdempotentCreate marks user creation as safe to retry. Set this only when the user
+	// microservice deduplicates requests by the "Idempotency-Key" header.
+	IdempotentCreate bool `json:"idempotentCreate,omitempty"`
+}
+
+// RetryPolicyConfig holds a retry policy. Zero values are inherited from the default policy.
+type RetryPolicyConfig struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+
+	// InitialBackoffMs is the delay before the first retry in milliseconds.
+	InitialBackoffMs int `json:"initialBackoffMs,omitempty"`
+
+	// MaxBackoffMs caps the delay between two attempts in milliseconds.
+	MaxBackoffMs int `json:"maxBackoffMs,omitempty"`
+
+	// Multiplier grows the backoff after every attempt.
+	Multiplier float64 `json:"multiplier,omitempty"`
+
+	// Jitter is the fraction (0-1) of the backoff that is randomized. 0 turns the jitter off.
+	Jitter *float64 `json:"jitter,omitempty"`
+
+	// RetryableStatusCodes lists the HTTP status codes that are retried.
+	RetryableStatusCodes []int `json:"retryableStatusCodes,omitempty"`
+
+	// RetryNetworkErrors enables retrying of connection errors.
+	RetryNetworkErrors *bool `json:"retryNetworkErrors,omitempty"`
+}
+
+// RetryBudgetConfig holds the retry budget configuration.
+type RetryBudgetConfig struct {
+	// MaxTokens is the capacity of the budget. Retries stop once less than half of it is left.
+	MaxTokens float64 `json:"maxTokens,omitempty"`
+
+	// TokenRatio is the number of tokens a successful call gives back. A failed call takes one token.
+	TokenRatio float64 `json:"tokenRatio,omitempty"`
+}
+
+// Defaults returns the configuration used as the base layer by Load.
+func Defaults() *Config {
+	return &Config{
+		Microservice: gateway.MicroserviceConfig{
+			MicroserviceName: "microservice-registration",
+			MicroservicePort: 8080,
+			Paths:            []string{"/users/register"},
+			Weight:           10,
+			ServicesMaxSlots: 100,
+		},
+		SystemKey: "/run/secrets/system",
+		RabbitMQ: RabbitMQConfig{
+			Port: 5672,
+		},
+	}
+}
+
+// Load loads the configuration in layers: the Defaults, then the configuration file
+// and then the REGISTRATION_* environment variables (see ApplyEnv). Every layer overrides
+// the values set by the previous ones. The file layer is skipped when confFile is empty.
+// The format of the file is detected by its extension (see FormatOf). Secret references
+// in the merged configuration are resolved last (see ResolveSecrets).
+func Load(confFile string) (*Config, error) {
+	return LoadFormat(confFile, FormatOf(confFile))
+}
+
+// LoadFormat loads the configuration like Load, reading the configuration file in the
+// given format regardless of its extension.
+func LoadFormat(confFile string, format Format) (*Config, error) {
+	config := Defaults()
+	if confFile != "" {
+		confBytes, err := ioutil.ReadFile(confFile)
+		if err != nil {
+			return nil, err
+		}
+		if err = decode(confBytes, format, config); err != nil {
+			return nil, fmt.Errorf("%s: %s", confFile, err)
+		}
+	}
+	if err := ApplyEnv(config, os.Environ()); err != nil {
 		return nil, err
 	}
-	config := &Config{}
-	err = json.Unmarshal(confBytes, config)
-	if err != nil {
+	if err := ResolveSecrets(config); err != nil {
 		return nil, err
 	}
 	return config, nil
 }
+
+// flexInt is an integer decoded from a JSON number or a numeric string.
+type flexInt int
+
+func (i *flexInt) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		if s == "" {
+			*i = 0
+			return nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		*i = flexInt(n)
+		return nil
+	}
+	var n int
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*i = flexInt(n)
+	return nil
+}
+
+// unknownProperties returns the sorted properties of the JSON object in data that do not
+// match a field of the struct pointed to by target.
+func unknownProperties(data []byte, target interface{}) ([]string, error) {
+	properties := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &properties); err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	structType := reflect.TypeOf(target).Elem()
+	for i := 0; i < structType.NumField(); i++ {
+		name := strings.Split(structType.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" {
+			known[strings.ToLower(name)] = true
+		}
+	}
+	unknown := []string{}
+	for property := range properties {
+		if !known[strings.ToLower(property)] {
+			unknown = append(unknown, property)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown, nil
+}
@@ -1,9 +1,16 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+
+	commonconf "github.com/Microkubes/microservice-tools/config"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -37,7 +44,7 @@ func TestLoadConfig(t *testing.T) {
 		}
 	  }`
 
-	cnfFile, err := ioutil.TempFile("", "tmp-config")
+	cnfFile, err := ioutil.TempFile("", "tmp-config-*.json")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -48,7 +55,7 @@ func TestLoadConfig(t *testing.T) {
 
 	cnfFile.Sync()
 
-	loadedCnf, err := LoadConfig(cnfFile.Name())
+	loadedCnf, err := Load(cnfFile.Name())
 
 	if err != nil {
 		t.Fatal(err)
@@ -58,3 +65,478 @@ func TestLoadConfig(t *testing.T) {
 		t.Fatal("Configuration was not read")
 	}
 }
+
+func TestServiceConfigUnmarshal(t *testing.T) {
+	cfg := &Config{}
+	err := json.Unmarshal([]byte(`{
+		"services": {
+			"user-microservice": "http://127.0.0.1:8080",
+			"microservice-user-profile": {
+				"url": "http://127.0.0.1:8082",
+				"token": {
+					"audience": "user-profile",
+					"roles": ["system", "admin"]
+				}
+			}
+		}
+	}`), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Services.UserMicroservice.URL != "http://127.0.0.1:8080" {
+		t.Fatal("expected the URL from the plain string")
+	}
+	if cfg.Services.UserMicroservice.Token != nil {
+		t.Fatal("expected no token config for the plain string")
+	}
+
+	profile := cfg.Services.UserProfile
+	if profile.URL != "http://127.0.0.1:8082" {
+		t.Fatal("expected the URL from the object")
+	}
+	if profile.Token == nil || profile.Token.Audience != "user-profile" || len(profile.Token.Roles) != 2 {
+		t.Fatalf("unexpected token config %+v", profile.Token)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	cnfFile, err := ioutil.TempFile("", "tmp-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(cnfFile.Name())
+	cnfFile.WriteString(`{
+		"gatewayAdminUrl": "http://kong:8001",
+		"services": {
+			"user-microservice": "http://127.0.0.1:8080",
+			"microservice-user-profile": "http://127.0.0.1:8082"
+		},
+		"rabbitmq": {
+			"username": "guest",
+			"password": "guest"
+		}
+	}`)
+	cnfFile.Sync()
+
+	os.Setenv("REGISTRATION_SERVICES_USER_MICROSERVICE", "http://user:8080")
+	os.Setenv("REGISTRATION_RABBITMQ_PASSWORD", "secret")
+	os.Setenv("REGISTRATION_MICROSERVICE_PORT", "9090")
+	defer os.Unsetenv("REGISTRATION_SERVICES_USER_MICROSERVICE")
+	defer os.Unsetenv("REGISTRATION_RABBITMQ_PASSWORD")
+	defer os.Unsetenv("REGISTRATION_MICROSERVICE_PORT")
+
+	cfg, err := Load(cnfFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// defaults
+	if cfg.Microservice.MicroserviceName != "microservice-registration" {
+		t.Fatal("expected the default microservice name")
+	}
+	if cfg.RabbitMQ.Port != 5672 {
+		t.Fatal("expected the default RabbitMQ port to be merged with the file")
+	}
+	// file
+	if cfg.GatewayAdminURL != "http://kong:8001" || cfg.RabbitMQ.Username != "guest" {
+		t.Fatal("expected the values from the file")
+	}
+	if cfg.Services.UserProfile.URL != "http://127.0.0.1:8082" {
+		t.Fatal("expected the profile service from the file")
+	}
+	// environment
+	if cfg.Services.UserMicroservice.URL != "http://user:8080" {
+		t.Fatalf("expected the user service from the environment, got %q", cfg.Services.UserMicroservice.URL)
+	}
+	if cfg.RabbitMQ.Password != "secret" {
+		t.Fatal("expected the RabbitMQ password from the environment")
+	}
+	if cfg.Microservice.MicroservicePort != 9090 {
+		t.Fatal("expected the port from the environment")
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	cfg := &Config{
+		Services: ServicesConfig{
+			UserMicroservice: ServiceConfig{
+				URL:   "http://user:8080",
+				Auth:  &AuthConfig{Type: AuthBasic, Username: "registration"},
+				Token: &TokenConfig{Audience: "users"},
+			},
+		},
+		Retry: &RetryConfig{
+			Calls: map[string]RetryPolicyConfig{
+				"create_user": {MaxAttempts: 1},
+			},
+		},
+	}
+	err := ApplyEnv(cfg, []string{
+		"PATH=/usr/bin",
+		"REGISTRATION_SERVICES_USER_MICROSERVICE=http://users:8080",
+		"REGISTRATION_GATEWAY_ADMIN_URL=http://kong-admin:8001",
+		"REGISTRATION_PREVIOUS_SYSTEM_KEYS=/keys/old.pem, /keys/older.pem",
+		"REGISTRATION_SERVICES_MICROSERVICE_USER_PROFILE_URL=http://profiles:8080",
+		"REGISTRATION_SERVICES_MICROSERVICE_USER_PROFILE_TOKEN_ROLES=system,admin",
+		"REGISTRATION_MESSAGING_ROUTES_RESEND_QUEUE=registration-email",
+		"REGISTRATION_RABBITMQ_HEARTBEAT_MS=5000",
+		"REGISTRATION_RETRY_CALLS_CREATE_USER_MAX_ATTEMPTS=3",
+		"REGISTRATION_RETRY_IDEMPOTENT_CREATE=true",
+		"REGISTRATION_ADMIN_ADDRESS=:9000",
+		"REGISTRATION_HTTP_PROXY_NO_PROXY=kong",
+		"REGISTRATION_HTTP_CA_FILES=[\"/etc/ca.pem\"]",
+		"REGISTRATION_RESILIENCE={\"commands\": {\"user-microservice.create_user\": {\"timeout\": 1000}}}",
+		"REGISTRATION_DATABASE_DB_INFO_HOST=mongo:27017",
+		"REGISTRATION_UNKNOWN=ignored",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.GatewayAdminURL != "http://kong-admin:8001" {
+		t.Fatal("expected the camel case property to be set")
+	}
+	if len(cfg.PreviousSystemKeys) != 2 || cfg.PreviousSystemKeys[1] != "/keys/older.pem" {
+		t.Fatalf("unexpected list %v", cfg.PreviousSystemKeys)
+	}
+	users := cfg.Services.UserMicroservice
+	if users.URL != "http://users:8080" || users.AuthType() != AuthBasic || users.Token == nil || users.Token.Audience != "users" {
+		t.Fatalf("expected only the URL of the service to be replaced, got %+v", users)
+	}
+	profile := cfg.Services.UserProfile
+	if profile.URL != "http://profiles:8080" || profile.Token == nil || len(profile.Token.Roles) != 2 {
+		t.Fatalf("unexpected profile service %+v", profile)
+	}
+	if cfg.RabbitMQ.HeartbeatMs != 5000 {
+		t.Fatalf("unexpected RabbitMQ settings %+v", cfg.RabbitMQ)
+	}
+	if resend := cfg.Messaging.Route(MessageResend); resend.Queue != "registration-email" || resend.Template != "userVerification" {
+		t.Fatalf("unexpected resend route %+v", resend)
+	}
+	if cfg.Retry.Calls["create_user"].MaxAttempts != 3 || !cfg.Retry.IdempotentCreate {
+		t.Fatal("expected the existing map entry with an underscore to be matched")
+	}
+	if cfg.Admin == nil || cfg.Admin.Address != ":9000" {
+		t.Fatal("expected the optional section to be created")
+	}
+	if cfg.HTTPClient == nil || cfg.HTTPClient.Proxy.NoProxy != "kong" || cfg.HTTPClient.CAFiles[0] != "/etc/ca.pem" {
+		t.Fatal("expected the nested HTTP client settings")
+	}
+	if cfg.Resilience == nil || cfg.Resilience.Commands["user-microservice.create_user"].Timeout != 1000 {
+		t.Fatal("expected the object from JSON")
+	}
+	if cfg.Database == nil || cfg.Database.Host != "mongo:27017" {
+		t.Fatal("expected the database host")
+	}
+
+	err = ApplyEnv(cfg, []string{"REGISTRATION_MICROSERVICE_PORT=http"})
+	if err == nil || !strings.Contains(err.Error(), "REGISTRATION_MICROSERVICE_PORT") {
+		t.Fatalf("expected an error naming the variable, got %v", err)
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	expected, err := Load("testdata/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected.Services.UserProfile.Token == nil || expected.Retry == nil {
+		t.Fatal("expected the JSON fixture to be loaded")
+	}
+
+	for _, file := range []string{"testdata/config.yaml", "testdata/config.toml"} {
+		cfg, err := Load(file)
+		if err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+		if !reflect.DeepEqual(cfg, expected) {
+			t.Fatalf("%s: expected the same configuration as the JSON fixture, got %+v", file, cfg)
+		}
+	}
+
+	// the format flag wins over the extension
+	if _, err := LoadFormat("testdata/config.yaml", TOML); err == nil {
+		t.Fatal("expected the YAML fixture to fail as TOML")
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	cases := map[string]Format{
+		"config.json": JSON,
+		"config.yml":  YAML,
+		"config.YAML": YAML,
+		"config.toml": TOML,
+		"config":      JSON,
+	}
+	for file, expected := range cases {
+		if format := FormatOf(file); format != expected {
+			t.Fatalf("%s: expected %s, got %s", file, expected, format)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	keyFile, err := ioutil.TempFile("", "system-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(keyFile.Name())
+
+	cfg := Defaults()
+	cfg.GatewayAdminURL = "http://kong:8001"
+	cfg.SystemKey = keyFile.Name()
+	cfg.Services = ServicesConfig{
+		UserMicroservice: ServiceConfig{URL: "http://kong:8000/users"},
+		UserProfile:      ServiceConfig{URL: "http://kong:8000/profiles"},
+	}
+	cfg.RabbitMQ = RabbitMQConfig{
+		Username: "guest",
+		Password: "guest",
+		Host:     "rabbitmq",
+		Port:     5672,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got %s", err)
+	}
+	if address := cfg.ListenAddress(); address != ":8080" {
+		t.Fatalf("expected the microservice port as listen address, got %s", address)
+	}
+
+	cfg.GatewayAdminURL = "kong:8001"
+	cfg.SystemKey = "/missing/system"
+	cfg.Services.UserProfile = ServiceConfig{Auth: &AuthConfig{Type: "oauth"}}
+	cfg.RabbitMQ = RabbitMQConfig{}
+	if err := json.Unmarshal([]byte(`{"username": "guest", "host": "rabbitmq", "post": "5672"}`), &cfg.RabbitMQ); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Messaging.Routes = map[string]RouteConfig{
+		"welcome": {Exchange: "emails", ExchangeType: "broadcast"},
+		"signup":  {Queue: "signup-email"},
+	}
+	cfg.Microservice.MicroservicePort = 70000
+	jitter := 2.0
+	cfg.Retry = &RetryConfig{
+		Default: RetryPolicyConfig{Jitter: &jitter, RetryableStatusCodes: []int{42}},
+	}
+	cfg.Resilience = &ResilienceConfig{
+		Commands: map[string]CommandConfig{"create": {ErrorPercentThreshold: 150}},
+	}
+	cfg.HTTPClient = &HTTPClientConfig{CertFile: "/missing/cert.pem", MinTLSVersion: "2.0"}
+	cfg.Gateway = &GatewayConfig{Registrar: "consul"}
+	sampleRatio := 1.5
+	cfg.Tracing = &TracingConfig{Exporter: "jaeger", SampleRatio: &sampleRatio}
+	cfg.Logging = &LoggingConfig{Level: "verbose"}
+	cfg.Audit = &AuditConfig{Sink: AuditFile, MaxBackups: -1}
+	cfg.Readiness = &ReadinessConfig{Checks: map[string]ReadinessCheckConfig{"amqp": {TimeoutMs: -1}}}
+	cfg.Async = &AsyncConfig{Workers: -2}
+	cfg.Database = &commonconf.DBConfig{DBName: "mongodb"}
+	cfg.Server = &ServerConfig{Address: "8080", TLS: &ServerTLSConfig{CertFile: "/missing/server.pem"}}
+
+	err = cfg.Validate()
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	expected := []string{
+		"microservice.port 70000",
+		"gatewayAdminUrl \"kong:8001\"",
+		"systemKey: cannot read /missing/system",
+		"services.microservice-user-profile.url is required",
+		"services.microservice-user-profile.auth.type \"oauth\"",
+		"rabbitmq.post is not a known property",
+		"rabbitmq.port 0",
+		"messaging.routes.signup is not a known message kind",
+		"messaging.routes.welcome.exchangeType \"broadcast\"",
+		"retry.default.jitter",
+		"retry.default.retryableStatusCodes: 42",
+		"resilience.commands.create.errorPercentThreshold",
+		"server.address \"8080\"",
+		"server.tls.certFile and server.tls.keyFile are required",
+		"server.tls.certFile: cannot read",
+		"http.certFile and http.keyFile must be set together",
+		"http.certFile: cannot read",
+		"http.minTlsVersion \"2.0\"",
+		"gateway.registrar \"consul\"",
+		"tracing.exporter \"jaeger\"",
+		"tracing.sampleRatio must be between 0 and 1",
+		"logging.level \"verbose\"",
+		"audit.file is required for the file sink",
+		"audit.maxBackups",
+		"readiness.checks.amqp.timeoutMs",
+		"async.workers",
+		"database.dbInfo.host is required",
+		"database.dbInfo.database is required",
+	}
+	if len(validationErr.Problems) != len(expected) {
+		t.Fatalf("expected %d problems, got:\n%s", len(expected), err)
+	}
+	for i, problem := range validationErr.Problems {
+		if !strings.HasPrefix(problem, expected[i]) {
+			t.Fatalf("expected problem %q, got %q", expected[i], problem)
+		}
+	}
+}
+
+func TestLegacyMapDecoding(t *testing.T) {
+	cfg := &Config{}
+	err := json.Unmarshal([]byte(`{
+		"mail": {
+			"host": "fakesmtp",
+			"port": "1025",
+			"user": "fake@email.com",
+			"password": "password",
+			"email": "dev@microkubes.org"
+		},
+		"rabbitmq": {
+			"username": "guest",
+			"password": "guest",
+			"host": "rabbitmq",
+			"port": "5672"
+		}
+	}`), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Mail.Port != 1025 || cfg.Mail.Email != "dev@microkubes.org" {
+		t.Fatalf("unexpected mail config %+v", cfg.Mail)
+	}
+	if cfg.RabbitMQ.Port != 5672 || cfg.RabbitMQ.Host != "rabbitmq" {
+		t.Fatalf("unexpected RabbitMQ config %+v", cfg.RabbitMQ)
+	}
+	if cfg.Messaging.Route(MessageVerification).Queue != "email-queue" || cfg.Messaging.Route(MessageResend).Queue != "verification-email" {
+		t.Fatal("expected the default queue names")
+	}
+
+	err = json.Unmarshal([]byte(`{"rabbitmq": {"port": "amqp"}}`), cfg)
+	if err == nil {
+		t.Fatal("expected an error for a non numeric port")
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "system")
+	ioutil.WriteFile(keyFile, []byte("key"), 0600)
+	confFile := filepath.Join(dir, "config.json")
+
+	write := func(userURL, adminURL, password string, concurrency int) {
+		conf := fmt.Sprintf(`{
+			"gatewayAdminUrl": %q,
+			"systemKey": %q,
+			"services": {
+				"user-microservice": %q,
+				"microservice-user-profile": "http://kong:8000/profiles"
+			},
+			"rabbitmq": {"username": "guest", "password": %q, "host": "rabbitmq"},
+			"resilience": {"commands": {"user-microservice.create_user": {"maxConcurrentRequests": %d}}}
+		}`, adminURL, keyFile, userURL, password, concurrency)
+		if err := ioutil.WriteFile(confFile, []byte(conf), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("http://kong:8000/users", "http://kong:8001", "guest", 10)
+	initial, err := Load(confFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewStore(initial)
+
+	var reloaded *Config
+	reloader := NewReloader(store, confFile, JSON, func(next *Config, changes []Change) {
+		reloaded = next
+	})
+
+	write("http://users:8080", "http://kong-admin:8001", "secret", 20)
+	changes, err := reloader.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Change{
+		{Path: "gatewayAdminUrl", Applied: false},
+		{Path: "rabbitmq.password", Applied: true},
+		{Path: "resilience.commands.user-microservice.create_user.maxConcurrentRequests", Applied: false},
+		{Path: "services.user-microservice.url", Applied: true},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+	current := store.Get()
+	if reloaded != current || current == initial {
+		t.Fatal("expected the configuration to be swapped")
+	}
+	if current.Services.UserMicroservice.URL != "http://users:8080" || current.RabbitMQ.Password != "secret" {
+		t.Fatal("expected the reloadable properties to be applied")
+	}
+	if current.GatewayAdminURL != "http://kong:8001" {
+		t.Fatal("expected the gateway admin URL to need a restart")
+	}
+	if current.Resilience.Commands["user-microservice.create_user"].MaxConcurrentRequests != 10 {
+		t.Fatal("expected the max concurrent requests to need a restart")
+	}
+	if initial.Services.UserMicroservice.URL != "http://kong:8000/users" {
+		t.Fatal("expected the previous configuration to stay unchanged")
+	}
+
+	// an invalid configuration is rejected
+	write("users", "http://kong:8001", "secret", 20)
+	if _, err := reloader.Reload(); err == nil {
+		t.Fatal("expected the invalid configuration to be rejected")
+	}
+	if store.Get() != current {
+		t.Fatal("expected the current configuration to be kept")
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	passwordFile := filepath.Join(dir, "rabbit_pw")
+	ioutil.WriteFile(passwordFile, []byte("rabbit-secret\n"), 0600)
+	os.Setenv("TEST_SMTP_PW", "smtp-secret")
+	defer os.Unsetenv("TEST_SMTP_PW")
+
+	cfg := &Config{
+		RabbitMQ: RabbitMQConfig{Username: "guest", Password: "file://" + passwordFile},
+		Mail:     MailConfig{Host: "smtp", Password: "env://TEST_SMTP_PW"},
+		Services: ServicesConfig{
+			UserMicroservice: ServiceConfig{
+				URL:  "http://kong:8000/users",
+				Auth: &AuthConfig{Type: AuthBasic, Username: "registration", Password: "env://TEST_SMTP_PW"},
+			},
+		},
+	}
+	if err := ResolveSecrets(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RabbitMQ.Password != "rabbit-secret" {
+		t.Fatalf("expected the password from the file, got %q", cfg.RabbitMQ.Password)
+	}
+	if cfg.Mail.Password != "smtp-secret" || cfg.Services.UserMicroservice.Auth.Password != "smtp-secret" {
+		t.Fatal("expected the passwords from the environment")
+	}
+
+	logged := cfg.String()
+	if strings.Contains(logged, "secret\"") || strings.Contains(logged, "rabbit-secret") || strings.Contains(logged, "smtp-secret") {
+		t.Fatalf("expected the secrets to be redacted: %s", logged)
+	}
+	if !strings.Contains(logged, `"password":"[REDACTED]"`) || !strings.Contains(logged, `"username":"guest"`) {
+		t.Fatalf("expected the redacted configuration: %s", logged)
+	}
+
+	cfg.Mail.Password = "env://TEST_MISSING_PW"
+	err = ResolveSecrets(cfg)
+	if err == nil || !strings.Contains(err.Error(), "mail.password") {
+		t.Fatalf("expected an error naming the property, got %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EnvPrefix is the prefix of the environment variables that override the configuration.
+const EnvPrefix = "REGISTRATION_"
+
+// ApplyEnv overrides the configuration with the REGISTRATION_* variables from environ,
+// given in the "key=value" form of os.Environ.
+//
+// The variable name is the path of JSON property names in upper snake case, so
+// "gatewayAdminUrl" is REGISTRATION_GATEWAY_ADMIN_URL and "rabbitmq.password" is
+// REGISTRATION_RABBITMQ_PASSWORD. Map entries are matched against the existing keys
+// ignoring case and punctuation, so REGISTRATION_SERVICES_USER_MICROSERVICE sets the
+// "user-microservice" service. A key that does not exist yet is added in lower case with
+// the underscores replaced by hyphens. Lists are given as comma separated values or as
+// JSON, and objects as JSON. A plain value given for an object with a "url" property,
+// such as a service, sets only the URL and keeps the rest of the object. Variables that
+// do not match any property are ignored.
+func ApplyEnv(cfg *Config, environ []string) error {
+	vars := map[string]string{}
+	names := []string{}
+	for _, entry := range environ {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], EnvPrefix) {
+			continue
+		}
+		vars[parts[0]] = parts[1]
+		names = append(names, parts[0])
+	}
+	// shorter names first, so that a whole object set from JSON can be refined by the
+	// variables of its properties
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) < len(names[j])
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		if _, err := setEnv(reflect.ValueOf(cfg).Elem(), strings.TrimPrefix(name, EnvPrefix), vars[name]); err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// setEnv sets the property of value at path to raw. It reports whether the path matched
+// a property.
+func setEnv(value reflect.Value, path, raw string) (bool, error) {
+	if path == "" {
+		return true, parseEnv(value, raw)
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.Type().Elem().Kind() != reflect.Struct {
+			return false, nil
+		}
+		target := reflect.New(value.Type().Elem())
+		if !value.IsNil() {
+			target.Elem().Set(value.Elem())
+		}
+		matched, err := setEnv(target.Elem(), path, raw)
+		if matched && err == nil {
+			value.Set(target)
+		}
+		return matched, err
+
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" && field.Anonymous {
+				if matched, err := setEnv(value.Field(i), path, raw); matched {
+					return true, err
+				}
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			if rest, ok := trimEnvName(path, envName(name)); ok {
+				if matched, err := setEnv(value.Field(i), rest, raw); matched {
+					return true, err
+				}
+			}
+		}
+		return false, nil
+
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return false, nil
+		}
+		return setEnvMapEntry(value, path, raw)
+	}
+	return false, nil
+}
+
+// setEnvMapEntry sets the entry of the map value that path starts with.
+func setEnvMapEntry(value reflect.Value, path, raw string) (bool, error) {
+	keys := []string{}
+	for _, key := range value.MapKeys() {
+		keys = append(keys, key.String())
+	}
+	// longer keys first, so that "user-microservice" wins over "user"
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+
+	set := func(key, rest string) (bool, error) {
+		entry := reflect.New(value.Type().Elem()).Elem()
+		if existing := value.MapIndex(reflect.ValueOf(key)); existing.IsValid() {
+			entry.Set(existing)
+		}
+		matched, err := setEnv(entry, rest, raw)
+		if matched && err == nil {
+			if value.IsNil() {
+				value.Set(reflect.MakeMap(value.Type()))
+			}
+			value.SetMapIndex(reflect.ValueOf(key), entry)
+		}
+		return matched, err
+	}
+
+	for _, key := range keys {
+		if rest, ok := trimEnvName(path, envName(key)); ok {
+			if matched, err := set(key, rest); matched {
+				return true, err
+			}
+		}
+	}
+
+	// a new entry: the longest key that leaves a matching object property wins,
+	// otherwise the whole path is the key
+	newKey := func(name string) string {
+		return strings.Replace(strings.ToLower(name), "_", "-", -1)
+	}
+	for i := len(path) - 1; i > 0; i-- {
+		if path[i] != '_' {
+			continue
+		}
+		if matched, err := set(newKey(path[:i]), path[i+1:]); matched {
+			return true, err
+		}
+	}
+	return set(newKey(path), "")
+}
+
+// parseEnv parses raw into value according to its type.
+func parseEnv(value reflect.Value, raw string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		value.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		value.SetInt(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		value.SetFloat(f)
+		return nil
+	case reflect.Ptr:
+		target := reflect.New(value.Type().Elem())
+		if err := parseEnv(target.Elem(), raw); err != nil {
+			return err
+		}
+		value.Set(target)
+		return nil
+	case reflect.Slice:
+		if strings.HasPrefix(strings.TrimSpace(raw), "[") {
+			return unmarshalEnv(value, raw)
+		}
+		items := reflect.MakeSlice(value.Type(), 0, 0)
+		for _, item := range strings.Split(raw, ",") {
+			elem := reflect.New(value.Type().Elem()).Elem()
+			if err := parseEnv(elem, strings.TrimSpace(item)); err != nil {
+				return err
+			}
+			items = reflect.Append(items, elem)
+		}
+		value.Set(items)
+		return nil
+	}
+
+	// a plain value for an object with a URL sets the URL only, so that the other
+	// properties from the file are kept
+	if value.Kind() == reflect.Struct && !strings.HasPrefix(strings.TrimSpace(raw), "{") {
+		if matched, err := setEnv(value, "URL", raw); matched {
+			return err
+		}
+	}
+
+	// objects are given as JSON; a plain string is tried as a JSON string, which covers
+	// the types with a string form
+	if err := unmarshalEnv(value, raw); err != nil {
+		quoted, _ := json.Marshal(raw)
+		if unmarshalEnv(value, string(quoted)) == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func unmarshalEnv(value reflect.Value, raw string) error {
+	target := reflect.New(value.Type())
+	if err := json.Unmarshal([]byte(raw), target.Interface()); err != nil {
+		return fmt.Errorf("invalid JSON value: %s", err)
+	}
+	value.Set(target.Elem())
+	return nil
+}
+
+// envName converts a JSON property name or map key to its environment variable form:
+// camel case words are split and everything but letters and digits becomes "_".
+func envName(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])):
+			b.WriteRune('_')
+			b.WriteRune(r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToUpper(r))
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// trimEnvName trims the property name from the start of path. It reports whether path
+// starts with the whole name.
+func trimEnvName(path, name string) (string, bool) {
+	if path == name {
+		return "", true
+	}
+	if strings.HasPrefix(path, name+"_") {
+		return path[len(name)+1:], true
+	}
+	return "", false
+}
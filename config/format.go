@@ -0,0 +1,98 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Format is the format of a configuration file.
+type Format string
+
+const (
+	// JSON is the JSON configuration format.
+	JSON Format = "json"
+
+	// YAML is the YAML configuration format.
+	YAML Format = "yaml"
+
+	// TOML is the TOML configuration format.
+	TOML Format = "toml"
+)
+
+// ParseFormat parses a format name: "json", "yaml" (or "yml") or "toml".
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "json":
+		return JSON, nil
+	case "yaml", "yml":
+		return YAML, nil
+	case "toml":
+		return TOML, nil
+	}
+	return "", fmt.Errorf("unknown configuration format %q", name)
+}
+
+// FormatOf detects the format of a configuration file by its extension. Files with
+// an unknown extension are read as JSON.
+func FormatOf(confFile string) Format {
+	if format, err := ParseFormat(strings.TrimPrefix(filepath.Ext(confFile), ".")); err == nil {
+		return format
+	}
+	return JSON
+}
+
+// decode decodes the configuration in the given format into config. YAML and TOML
+// documents are converted to JSON first, so that every format maps to the Config
+// struct through the same property names and decoders.
+func decode(data []byte, format Format, config *Config) error {
+	switch format {
+	case JSON:
+		return json.Unmarshal(data, config)
+	case YAML:
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		return remarshal(stringKeys(doc), config)
+	case TOML:
+		doc := map[string]interface{}{}
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		return remarshal(doc, config)
+	}
+	return fmt.Errorf("unknown configuration format %q", format)
+}
+
+func remarshal(doc interface{}, config *Config) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, config)
+}
+
+// stringKeys converts the map[interface{}]interface{} maps produced by the YAML decoder
+// to maps with string keys.
+func stringKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := map[string]interface{}{}
+		for key, item := range v {
+			result[fmt.Sprint(key)] = stringKeys(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = stringKeys(item)
+		}
+		return result
+	}
+	return value
+}
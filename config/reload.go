@@ -0,0 +1,286 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Store holds the current configuration. The configuration is replaced as a whole, so
+// a *Config obtained from Get is never modified and can be used for the whole request.
+type Store struct {
+	value atomic.Value
+}
+
+// NewStore creates a Store holding cfg.
+func NewStore(cfg *Config) *Store {
+	store := &Store{}
+	store.Set(cfg)
+	return store
+}
+
+// Get returns the current configuration.
+func (s *Store) Get() *Config {
+	return s.value.Load().(*Config)
+}
+
+// Set replaces the current configuration.
+func (s *Store) Set(cfg *Config) {
+	s.value.Store(cfg)
+}
+
+// reloadable lists the properties that are applied on reload. Changes of the other
+// properties (the microservice and gateway registration, the listeners, the keys and the
+// HTTP client) need a restart.
+var reloadable = map[string]bool{
+	"services":   true,
+	"mail":       true,
+	"rabbitmq":   true,
+	"messaging":  true,
+	"resilience": true,
+}
+
+// Reloadable reports whether changes of the top level property (by its JSON name) are
+// applied on reload.
+func Reloadable(property string) bool {
+	return reloadable[property]
+}
+
+// restartRequired reports whether changes of the property at path need a restart even
+// though its top level property is reloadable. The hystrix pool of a command is sized
+// when the command first runs, so the maxConcurrentRequests of the resilience commands
+// is not applied on reload.
+func restartRequired(path string) bool {
+	return topLevel(path) == "resilience" && strings.HasSuffix(path, ".maxConcurrentRequests")
+}
+
+// Change is a changed configuration property.
+type Change struct {
+	// Path is the dotted path of the property, for example "services.user-microservice.url".
+	Path string
+
+	// Applied is false for the changes that need a restart.
+	Applied bool
+}
+
+func (c Change) String() string {
+	if c.Applied {
+		return c.Path
+	}
+	return fmt.Sprintf("%s (restart required)", c.Path)
+}
+
+// Reloader reloads the configuration file into a Store.
+type Reloader struct {
+	store    *Store
+	confFile string
+	format   Format
+
+	// mu serializes the reloads
+	mu       sync.Mutex
+	stamp    fileStamp
+	onReload func(*Config, []Change)
+}
+
+// fileStamp identifies a version of the configuration file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader creates a Reloader for the configuration file in the given format.
+// onReload is called with the new configuration and the changes after every reload
+// that changed something.
+func NewReloader(store *Store, confFile string, format Format, onReload func(*Config, []Change)) *Reloader {
+	reloader := &Reloader{
+		store:    store,
+		confFile: confFile,
+		format:   format,
+		onReload: onReload,
+	}
+	reloader.stamp, _ = stat(confFile)
+	return reloader
+}
+
+// Reload loads and validates the configuration and swaps the reloadable properties into
+// the store. An invalid configuration is rejected and the current one stays in use.
+func (r *Reloader) Reload() ([]Change, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stamp, _ = stat(r.confFile)
+	next, err := LoadFormat(r.confFile, r.format)
+	if err != nil {
+		return nil, err
+	}
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+
+	current := r.store.Get()
+	changes, err := Diff(current, next)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	merged := *current
+	merged.Services = next.Services
+	merged.Mail = next.Mail
+	merged.RabbitMQ = next.RabbitMQ
+	merged.Messaging = next.Messaging
+	merged.Resilience = keepConcurrency(current.Resilience, next.Resilience)
+	r.store.Set(&merged)
+
+	if r.onReload != nil {
+		r.onReload(&merged, changes)
+	}
+	return changes, nil
+}
+
+// Watch polls the configuration file every interval and reloads it when the file
+// changes. Reload errors are passed to onError. Watch blocks until stop is closed.
+func (r *Reloader) Watch(interval time.Duration, stop <-chan struct{}, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			stamp, err := stat(r.confFile)
+			if err != nil {
+				onError(err)
+				continue
+			}
+			r.mu.Lock()
+			changed := stamp != r.stamp
+			r.mu.Unlock()
+			if !changed {
+				continue
+			}
+			if _, err := r.Reload(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Diff returns the properties that differ between two configurations, sorted by path.
+// Only the paths are reported, so that no secrets end up in the logs.
+func Diff(current, next *Config) ([]Change, error) {
+	currentProps, err := flatten(current)
+	if err != nil {
+		return nil, err
+	}
+	nextProps, err := flatten(next)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := map[string]bool{}
+	for path, value := range currentProps {
+		if other, ok := nextProps[path]; !ok || !reflect.DeepEqual(value, other) {
+			paths[path] = true
+		}
+	}
+	for path := range nextProps {
+		if _, ok := currentProps[path]; !ok {
+			paths[path] = true
+		}
+	}
+
+	changes := []Change{}
+	for path := range paths {
+		changes = append(changes, Change{
+			Path:    path,
+			Applied: Reloadable(topLevel(path)) && !restartRequired(path),
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// keepConcurrency returns the next resilience settings with the maxConcurrentRequests
+// of the current ones, as changing it needs a restart.
+func keepConcurrency(current, next *ResilienceConfig) *ResilienceConfig {
+	if next == nil && (current == nil || len(current.Commands) == 0) {
+		return next
+	}
+	kept := &ResilienceConfig{Commands: map[string]CommandConfig{}}
+	if next != nil {
+		for name, command := range next.Commands {
+			command.MaxConcurrentRequests = 0
+			kept.Commands[name] = command
+		}
+	}
+	if current != nil {
+		for name, command := range current.Commands {
+			if command.MaxConcurrentRequests == 0 {
+				continue
+			}
+			override := kept.Commands[name]
+			override.MaxConcurrentRequests = command.MaxConcurrentRequests
+			kept.Commands[name] = override
+		}
+	}
+	return kept
+}
+
+// flatten maps the dotted paths of the leaf properties of cfg to their values.
+func flatten(cfg *Config) (map[string]interface{}, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	props := map[string]interface{}{}
+	var walk func(prefix string, value interface{})
+	walk = func(prefix string, value interface{}) {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			props[prefix] = value
+			return
+		}
+		for key, item := range object {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			walk(path, item)
+		}
+	}
+	walk("", doc)
+	return props, nil
+}
+
+func topLevel(path string) string {
+	for i, r := range path {
+		if r == '.' {
+			return path[:i]
+		}
+	}
+	return path
+}
+
+func stat(file string) (fileStamp, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}, nil
+}
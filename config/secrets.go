@@ -0,0 +1,152 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Secret reference schemes. A string value of the form "file:///run/secrets/rabbit_pw" is
+// replaced with the content of the file and "env://RABBIT_PW" with the value of the
+// environment variable.
+const (
+	FileReference = "file://"
+	EnvReference  = "env://"
+)
+
+// Redacted replaces the secret values in String.
+const Redacted = "[REDACTED]"
+
+// ResolveSecrets replaces the secret references in every string value of the configuration
+// with the referenced values.
+func ResolveSecrets(cfg *Config) error {
+	return resolve(reflect.ValueOf(cfg).Elem(), "")
+}
+
+func resolve(value reflect.Value, path string) error {
+	switch value.Kind() {
+	case reflect.String:
+		resolved, err := resolveReference(value.String())
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		value.SetString(resolved)
+	case reflect.Ptr:
+		if !value.IsNil() {
+			return resolve(value.Elem(), path)
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = field.Name
+			}
+			if field.Anonymous && field.Tag.Get("json") == "" {
+				name = ""
+			}
+			if err := resolve(value.Field(i), joinPath(path, name)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			if err := resolve(value.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range value.MapKeys() {
+			// map entries are not addressable, so resolve a copy and put it back
+			entry := reflect.New(value.Type().Elem()).Elem()
+			entry.Set(value.MapIndex(key))
+			if err := resolve(entry, joinPath(path, fmt.Sprint(key.Interface()))); err != nil {
+				return err
+			}
+			value.SetMapIndex(key, entry)
+		}
+	}
+	return nil
+}
+
+func resolveReference(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, FileReference):
+		data, err := ioutil.ReadFile(strings.TrimPrefix(value, FileReference))
+		if err != nil {
+			return "", fmt.Errorf("secret reference %s: %s", value, unwrapPathError(err))
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(value, EnvReference):
+		name := strings.TrimPrefix(value, EnvReference)
+		resolved, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("secret reference %s: environment variable %s is not set", value, name)
+		}
+		return resolved, nil
+	}
+	return value, nil
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" || name == "" {
+		return prefix + name
+	}
+	return prefix + "." + name
+}
+
+// String returns the configuration as JSON with the secret values (passwords, secret keys
+// and session tokens) redacted, for logging the effective configuration.
+func (c *Config) String() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Sprintf("config: %s", err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Sprintf("config: %s", err)
+	}
+	redacted, err := json.Marshal(redact(doc))
+	if err != nil {
+		return fmt.Sprintf("config: %s", err)
+	}
+	return string(redacted)
+}
+
+// redact replaces the non empty values of the secret properties in a decoded JSON document.
+func redact(doc interface{}) interface{} {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if secret(key) {
+				if s, ok := item.(string); !ok || s != "" {
+					v[key] = Redacted
+				}
+				continue
+			}
+			v[key] = redact(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redact(item)
+		}
+	}
+	return doc
+}
+
+// secret reports whether a property holds a secret, judging by its name.
+func secret(property string) bool {
+	name := strings.ToLower(property)
+	for _, marker := range []string{"pass", "secret", "sessiontoken"} {
+		if strings.Contains(name, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,386 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ValidationError lists every problem found in a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n  - %s", strings.Join(e.Problems, "\n  - "))
+}
+
+// validator collects the problems found in a configuration.
+type validator struct {
+	problems []string
+}
+
+func (v *validator) problem(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// Validate checks the configuration and returns a *ValidationError listing all problems,
+// or nil when the configuration is valid.
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	if c.Microservice.MicroserviceName == "" {
+		v.problem("microservice.name is required")
+	}
+	v.port("microservice.port", c.Microservice.MicroservicePort)
+	v.url("gatewayAdminUrl", c.GatewayAdminURL, c.Gateway.RegistrarType() == RegistrarKong)
+	v.url("gatewayUrl", c.GatewayURL, false)
+
+	if c.SystemKey == "" {
+		v.problem("systemKey is required")
+	} else {
+		v.readable("systemKey", c.SystemKey)
+	}
+	for i, keyFile := range c.PreviousSystemKeys {
+		v.readable(fmt.Sprintf("previousSystemKeys[%d]", i), keyFile)
+	}
+
+	v.service("services.user-microservice", c.Services.UserMicroservice)
+	v.service("services.microservice-user-profile", c.Services.UserProfile)
+
+	v.rabbitMQ(c.RabbitMQ)
+	v.messaging(c.Messaging)
+	v.mail(c.Mail)
+
+	if c.Retry != nil {
+		v.retryPolicy("retry.default", c.Retry.Default)
+		for _, kind := range sortedKeys(c.Retry.Calls) {
+			v.retryPolicy(fmt.Sprintf("retry.calls.%s", kind), c.Retry.Calls[kind])
+		}
+		v.min("retry.budget.maxTokens", c.Retry.Budget.MaxTokens, 0)
+		v.min("retry.budget.tokenRatio", c.Retry.Budget.TokenRatio, 0)
+	}
+
+	if c.Resilience != nil {
+		for _, name := range sortedKeys(c.Resilience.Commands) {
+			command := c.Resilience.Commands[name]
+			prefix := fmt.Sprintf("resilience.commands.%s", name)
+			v.min(prefix+".timeout", float64(command.Timeout), 0)
+			v.min(prefix+".maxConcurrentRequests", float64(command.MaxConcurrentRequests), 0)
+			v.between(prefix+".errorPercentThreshold", float64(command.ErrorPercentThreshold), 0, 100)
+			v.min(prefix+".sleepWindow", float64(command.SleepWindow), 0)
+			v.min(prefix+".requestVolumeThreshold", float64(command.RequestVolumeThreshold), 0)
+		}
+	}
+
+	if c.Admin != nil && c.Admin.Address != "" {
+		v.address("admin.address", c.Admin.Address)
+	}
+
+	if c.Server != nil {
+		if c.Server.Address != "" {
+			v.address("server.address", c.Server.Address)
+		}
+		if c.Server.TLS != nil {
+			if c.Server.TLS.CertFile == "" || c.Server.TLS.KeyFile == "" {
+				v.problem("server.tls.certFile and server.tls.keyFile are required")
+			}
+			if c.Server.TLS.CertFile != "" {
+				v.readable("server.tls.certFile", c.Server.TLS.CertFile)
+			}
+			if c.Server.TLS.KeyFile != "" {
+				v.readable("server.tls.keyFile", c.Server.TLS.KeyFile)
+			}
+		}
+	}
+
+	if c.HTTPClient != nil {
+		v.httpClient(c.HTTPClient)
+	}
+
+	if c.Gateway != nil {
+		switch c.Gateway.RegistrarType() {
+		case RegistrarKong, RegistrarNone:
+		case RegistrarStatic:
+			if c.Gateway.StaticFile == "" {
+				v.problem("gateway.staticFile is required for the static registrar")
+			}
+		default:
+			v.problem("gateway.registrar %q is not one of %s, %s or %s", c.Gateway.Registrar, RegistrarKong, RegistrarStatic, RegistrarNone)
+		}
+		v.min("gateway.initialBackoffMs", float64(c.Gateway.InitialBackoffMs), 0)
+		v.min("gateway.maxBackoffMs", float64(c.Gateway.MaxBackoffMs), 0)
+		v.min("gateway.attemptTimeoutMs", float64(c.Gateway.AttemptTimeoutMs), 0)
+	}
+
+	if c.Tracing != nil {
+		switch c.Tracing.ExporterType() {
+		case TracingNone, TracingOTLP, TracingStdout:
+		case TracingFile:
+			if c.Tracing.File == "" {
+				v.problem("tracing.file is required for the file exporter")
+			}
+		default:
+			v.problem("tracing.exporter %q is not one of %s, %s, %s or %s", c.Tracing.Exporter, TracingNone, TracingOTLP, TracingStdout, TracingFile)
+		}
+		if c.Tracing.SampleRatio != nil {
+			v.between("tracing.sampleRatio", *c.Tracing.SampleRatio, 0, 1)
+		}
+	}
+
+	if c.Logging != nil {
+		switch strings.ToLower(c.Logging.LogLevel()) {
+		case "debug", "info", "warn", "error":
+		default:
+			v.problem("logging.level %q is not one of debug, info, warn or error", c.Logging.Level)
+		}
+	}
+
+	if c.Audit != nil {
+		switch c.Audit.SinkType() {
+		case AuditNone, AuditSyslog, AuditAMQP:
+		case AuditFile:
+			if c.Audit.File == "" {
+				v.problem("audit.file is required for the file sink")
+			}
+		default:
+			v.problem("audit.sink %q is not one of %s, %s, %s or %s", c.Audit.Sink, AuditNone, AuditFile, AuditSyslog, AuditAMQP)
+		}
+		v.min("audit.maxSizeMB", float64(c.Audit.MaxSizeMB), 0)
+		v.min("audit.maxBackups", float64(c.Audit.MaxBackups), 0)
+	}
+
+	if c.Readiness != nil {
+		v.min("readiness.timeoutMs", float64(c.Readiness.TimeoutMs), 0)
+		v.min("readiness.cacheMs", float64(c.Readiness.CacheMs), 0)
+		for _, name := range sortedKeys(c.Readiness.Checks) {
+			v.min(fmt.Sprintf("readiness.checks.%s.timeoutMs", name), float64(c.Readiness.Checks[name].TimeoutMs), 0)
+		}
+	}
+
+	if c.Async != nil {
+		v.min("async.workers", float64(c.Async.Workers), 0)
+		v.min("async.queueSize", float64(c.Async.QueueSize), 0)
+		v.min("async.maxAttempts", float64(c.Async.MaxAttempts), 0)
+		v.min("async.backoffMs", float64(c.Async.BackoffMs), 0)
+		v.min("async.maxBackoffMs", float64(c.Async.MaxBackoffMs), 0)
+		v.min("async.orphanAfterMs", float64(c.Async.OrphanAfterMs), 0)
+	}
+
+	if c.Database != nil {
+		switch c.Database.DBName {
+		case "", DatabaseMemory:
+		case DatabaseMongo:
+			if c.Database.Host == "" {
+				v.problem("database.dbInfo.host is required for %s", DatabaseMongo)
+			}
+			if c.Database.DatabaseName == "" {
+				v.problem("database.dbInfo.database is required for %s", DatabaseMongo)
+			}
+		default:
+			v.problem("database.dbName %q is not one of %s or %s", c.Database.DBName, DatabaseMemory, DatabaseMongo)
+		}
+	}
+
+	if c.Shutdown != nil {
+		v.min("shutdown.gracePeriodMs", float64(c.Shutdown.GracePeriodMs), 0)
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+func (v *validator) service(name string, service ServiceConfig) {
+	v.url(name+".url", service.URL, true)
+	v.min(name+".timeoutMs", float64(service.TimeoutMs), 0)
+	switch service.AuthType() {
+	case AuthSystemToken, AuthNone:
+	case AuthBasic:
+		if service.Auth.Username == "" {
+			v.problem("%s.auth.username is required for basic authentication", name)
+		}
+	default:
+		v.problem("%s.auth.type %q is not one of %s, %s or %s", name, service.Auth.Type, AuthSystemToken, AuthBasic, AuthNone)
+	}
+}
+
+func (v *validator) rabbitMQ(rabbitMQ RabbitMQConfig) {
+	for _, property := range rabbitMQ.unknown {
+		v.problem("rabbitmq.%s is not a known property", property)
+	}
+	if rabbitMQ.Username == "" {
+		v.problem("rabbitmq.username is required")
+	}
+	if rabbitMQ.Host == "" {
+		v.problem("rabbitmq.host is required")
+	}
+	v.port("rabbitmq.port", rabbitMQ.Port)
+	v.min("rabbitmq.heartbeatMs", float64(rabbitMQ.HeartbeatMs), 0)
+	if rabbitMQ.TLS != nil {
+		v.tls("rabbitmq.tls", rabbitMQ.TLS)
+	}
+}
+
+func (v *validator) messaging(messaging MessagingConfig) {
+	defaults := DefaultRoutes()
+	for _, kind := range sortedKeys(messaging.Routes) {
+		if _, ok := defaults[kind]; !ok {
+			v.problem("messaging.routes.%s is not a known message kind (expected verification, resend, welcome or invite)", kind)
+			continue
+		}
+		route := messaging.Route(kind)
+		if route.Exchange == "" && route.Queue == "" {
+			v.problem("messaging.routes.%s needs an exchange or a queue", kind)
+		}
+		switch route.ExchangeType {
+		case "direct", "fanout", "topic", "headers":
+		default:
+			v.problem("messaging.routes.%s.exchangeType %q is not one of direct, fanout, topic or headers", kind, route.ExchangeType)
+		}
+	}
+}
+
+func (v *validator) mail(mail MailConfig) {
+	for _, property := range mail.unknown {
+		v.problem("mail.%s is not a known property", property)
+	}
+	if mail.Host != "" || mail.Port != 0 {
+		v.port("mail.port", mail.Port)
+	}
+}
+
+func (v *validator) tls(name string, cfg *TLSConfig) {
+	if cfg.CAFile != "" {
+		v.readable(name+".caFile", cfg.CAFile)
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		v.problem("%s.certFile and %s.keyFile must be set together", name, name)
+	}
+	if cfg.CertFile != "" {
+		v.readable(name+".certFile", cfg.CertFile)
+	}
+	if cfg.KeyFile != "" {
+		v.readable(name+".keyFile", cfg.KeyFile)
+	}
+}
+
+func (v *validator) retryPolicy(name string, policy RetryPolicyConfig) {
+	v.min(name+".maxAttempts", float64(policy.MaxAttempts), 0)
+	v.min(name+".initialBackoffMs", float64(policy.InitialBackoffMs), 0)
+	v.min(name+".maxBackoffMs", float64(policy.MaxBackoffMs), 0)
+	if policy.Multiplier != 0 {
+		v.min(name+".multiplier", policy.Multiplier, 1)
+	}
+	if policy.Jitter != nil {
+		v.between(name+".jitter", *policy.Jitter, 0, 1)
+	}
+	for _, status := range policy.RetryableStatusCodes {
+		if status < 100 || status > 599 {
+			v.problem("%s.retryableStatusCodes: %d is not an HTTP status code", name, status)
+		}
+	}
+}
+
+func (v *validator) httpClient(cfg *HTTPClientConfig) {
+	for i, caFile := range cfg.CAFiles {
+		v.readable(fmt.Sprintf("http.caFiles[%d]", i), caFile)
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		v.problem("http.certFile and http.keyFile must be set together")
+	}
+	if cfg.CertFile != "" {
+		v.readable("http.certFile", cfg.CertFile)
+	}
+	if cfg.KeyFile != "" {
+		v.readable("http.keyFile", cfg.KeyFile)
+	}
+	switch cfg.MinTLSVersion {
+	case "", "1.0", "1.1", "1.2", "1.3":
+	default:
+		v.problem("http.minTlsVersion %q is not one of 1.0, 1.1, 1.2 or 1.3", cfg.MinTLSVersion)
+	}
+	v.min("http.maxIdleConns", float64(cfg.MaxIdleConns), 0)
+	v.min("http.maxIdleConnsPerHost", float64(cfg.MaxIdleConnsPerHost), 0)
+	v.min("http.maxConnsPerHost", float64(cfg.MaxConnsPerHost), 0)
+	v.min("http.idleConnTimeoutMs", float64(cfg.IdleConnTimeoutMs), 0)
+	v.min("http.timeoutMs", float64(cfg.TimeoutMs), 0)
+	if cfg.Proxy != nil {
+		v.url("http.proxy.httpProxy", cfg.Proxy.HTTPProxy, false)
+		v.url("http.proxy.httpsProxy", cfg.Proxy.HTTPSProxy, false)
+	}
+}
+
+// url checks that value is an absolute http(s) URL.
+func (v *validator) url(name, value string, required bool) {
+	if value == "" {
+		if required {
+			v.problem("%s is required", name)
+		}
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		v.problem("%s %q is not a valid URL: %s", name, value, err)
+		return
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.problem("%s %q must be an absolute http or https URL", name, value)
+	}
+}
+
+func (v *validator) address(name, address string) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		v.problem("%s %q is not a valid listen address: %s", name, address, err)
+	}
+}
+
+func (v *validator) readable(name, file string) {
+	f, err := os.Open(file)
+	if err != nil {
+		v.problem("%s: cannot read %s: %s", name, file, unwrapPathError(err))
+		return
+	}
+	f.Close()
+}
+
+func (v *validator) port(name string, port int) {
+	if port < 1 || port > 65535 {
+		v.problem("%s %d is not a valid port (1-65535)", name, port)
+	}
+}
+
+func (v *validator) min(name string, value, min float64) {
+	if value < min {
+		v.problem("%s must be at least %v, got %v", name, min, value)
+	}
+}
+
+func (v *validator) between(name string, value, min, max float64) {
+	if value < min || value > max {
+		v.problem("%s must be between %v and %v, got %v", name, min, max, value)
+	}
+}
+
+func unwrapPathError(err error) error {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return pathErr.Err
+	}
+	return err
+}
+
+// sortedKeys returns the keys of a map with string keys in sorted order, so that the
+// problems are reported in a stable order.
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
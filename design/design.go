@@ -28,10 +28,15 @@ var _ = Resource("user", func() {
 	Action("register", func() {
 		Description("Creates user")
 		Routing(POST("/register"))
+		Params(func() {
+			Param("async", Boolean, "Process the registration asynchronously, overriding the configured mode")
+		})
 		Payload(UserPayload)
 		Response(Created, UserMedia)
+		Response(Accepted, RegistrationStatusMedia)
 		Response(BadRequest, ErrorMedia)
 		Response(InternalServerError, ErrorMedia)
+		Response(ServiceUnavailable, ErrorMedia)
 	})
 
 	Action("resendVerification", func() {
@@ -43,6 +48,41 @@ var _ = Resource("user", func() {
 		Response(InternalServerError, ErrorMedia)
 	})
 
+	Action("registrationStatus", func() {
+		Description("Returns where a registration is in its lifecycle")
+		Routing(GET("/register/:id/status"))
+		Params(func() {
+			Param("id", String, "Registration ID")
+		})
+		Response(OK, RegistrationStatusMedia)
+		Response(NotFound, ErrorMedia)
+		Response(InternalServerError, ErrorMedia)
+	})
+
+	Action("confirmVerification", func() {
+		Description("Moves a registration to verified once the user microservice reports the user as active")
+		Routing(POST("/register/:id/verified"))
+		Params(func() {
+			Param("id", String, "Registration ID")
+		})
+		Response(OK, RegistrationStatusMedia)
+		Response(NotFound, ErrorMedia)
+		Response(Conflict, ErrorMedia)
+		Response(InternalServerError, ErrorMedia)
+	})
+
+})
+
+// Resource for publishing the public keys of the system key used to sign service-to-service tokens.
+var _ = Resource("jwks", func() {
+	Description("The JSON Web Key Set of the service")
+
+	Action("jwks", func() {
+		Description("Publishes the public keys for verifying the self-signed system tokens")
+		Routing(GET("/.well-known/jwks.json"))
+		Response(OK, JWKSetMedia)
+		Response(InternalServerError, ErrorMedia)
+	})
 })
 
 // UserMedia defines the media type used to render user.
@@ -105,6 +145,88 @@ var ResendVerificationPayload = Type("ResendVerificationPayload", func() {
 	Required("email")
 })
 
+// RegistrationTransition is a state change of a registration.
+var RegistrationTransition = Type("RegistrationTransition", func() {
+	Description("A state change of a registration")
+	Attribute("state", String, "The state the registration moved to")
+	Attribute("at", DateTime, "When the registration moved to the state")
+	Attribute("error", String, "The error that failed the registration")
+	Required("state", "at")
+})
+
+// RegistrationStatusMedia defines the media type used to render the state of a registration.
+var RegistrationStatusMedia = MediaType("application/vnd.goa.registration-status+json", func() {
+	TypeName("RegistrationStatus")
+	Description("Where a registration is in its lifecycle")
+
+	Attributes(func() {
+		Attribute("id", String, "Registration ID")
+		Attribute("userId", String, "ID of the created user")
+		Attribute("state", String, "Current state: pending, user_created, profile_created, mail_queued, verified or failed")
+		Attribute("error", String, "The error that failed the registration")
+		Attribute("createdAt", DateTime, "When the registration started")
+		Attribute("updatedAt", DateTime, "When the registration last changed state")
+		Attribute("history", ArrayOf(RegistrationTransition), "The state changes, oldest first")
+		Required("id", "state", "createdAt", "updatedAt", "history")
+	})
+
+	View("default", func() {
+		Attribute("id")
+		Attribute("userId")
+		Attribute("state")
+		Attribute("error")
+		Attribute("createdAt")
+		Attribute("updatedAt")
+		Attribute("history")
+	})
+})
+
+// JWKMedia defines the media type used to render a public JSON Web Key.
+var JWKMedia = MediaType("application/jwk+json", func() {
+	TypeName("JWK")
+	Description("Public JSON Web Key (RFC 7517)")
+
+	Attributes(func() {
+		Attribute("kty", String, "Key type (RSA, EC or OKP)")
+		Attribute("kid", String, "Key ID, the RFC 7638 thumbprint of the key")
+		Attribute("use", String, "Public key use")
+		Attribute("alg", String, "Signing algorithm")
+		Attribute("n", String, "RSA modulus")
+		Attribute("e", String, "RSA public exponent")
+		Attribute("crv", String, "Curve of an EC or OKP key")
+		Attribute("x", String, "X coordinate of an EC key or the OKP public key")
+		Attribute("y", String, "Y coordinate of an EC key")
+		Required("kty", "kid", "use", "alg")
+	})
+
+	View("default", func() {
+		Attribute("kty")
+		Attribute("kid")
+		Attribute("use")
+		Attribute("alg")
+		Attribute("n")
+		Attribute("e")
+		Attribute("crv")
+		Attribute("x")
+		Attribute("y")
+	})
+})
+
+// JWKSetMedia defines the media type used to render the JSON Web Key Set.
+var JWKSetMedia = MediaType("application/jwk-set+json", func() {
+	TypeName("JWKSet")
+	Description("JSON Web Key Set (RFC 7517)")
+
+	Attributes(func() {
+		Attribute("keys", ArrayOf(JWKMedia), "Public keys")
+		Required("keys")
+	})
+
+	View("default", func() {
+		Attribute("keys")
+	})
+})
+
 // Swagger UI
 var _ = Resource("swagger", func() {
 	Description("The API swagger specification")
@@ -0,0 +1,144 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Microkubes/microservice-registration/config"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Defaults of the connection pool, matching http.DefaultTransport.
+const (
+	DefaultMaxIdleConns    = 100
+	DefaultIdleConnTimeout = 90 * time.Second
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// New builds the HTTP client for the calls to the downstream services. A nil
+// configuration gives a client with the default settings.
+func New(cfg *config.HTTPClientConfig) (*http.Client, error) {
+	if cfg == nil {
+		cfg = &config.HTTPClientConfig{}
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := newProxy(cfg.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		MaxIdleConns:          DefaultMaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       DefaultIdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if cfg.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.IdleConnTimeoutMs > 0 {
+		transport.IdleConnTimeout = time.Duration(cfg.IdleConnTimeoutMs) * time.Millisecond
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(cfg.TimeoutMs) * time.Millisecond,
+	}, nil
+}
+
+func newTLSConfig(cfg *config.HTTPClientConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if cfg.MinTLSVersion != "" {
+		version, ok := tlsVersions[cfg.MinTLSVersion]
+		if !ok {
+			return nil, fmt.Errorf("http client: unknown TLS version %q", cfg.MinTLSVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if len(cfg.CAFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, caFile := range cfg.CAFiles {
+			pem, err := ioutil.ReadFile(caFile)
+			if err != nil {
+				return nil, fmt.Errorf("http client: CA bundle: %s", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("http client: no certificates found in CA bundle %s", caFile)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, fmt.Errorf("http client: both certFile and keyFile are required for mutual TLS")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("http client: client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func newProxy(cfg *config.ProxyConfig) (func(*http.Request) (*url.URL, error), error) {
+	if cfg == nil {
+		return http.ProxyFromEnvironment, nil
+	}
+	for _, proxyURL := range []string{cfg.HTTPProxy, cfg.HTTPSProxy} {
+		if proxyURL == "" {
+			continue
+		}
+		if _, err := url.Parse(proxyURL); err != nil {
+			return nil, fmt.Errorf("http client: invalid proxy URL: %s", err)
+		}
+	}
+	// the settings of the file override those of the environment one by one
+	proxyConfig := httpproxy.FromEnvironment()
+	if cfg.HTTPProxy != "" {
+		proxyConfig.HTTPProxy = cfg.HTTPProxy
+	}
+	if cfg.HTTPSProxy != "" {
+		proxyConfig.HTTPSProxy = cfg.HTTPSProxy
+	}
+	if cfg.NoProxy != "" {
+		proxyConfig.NoProxy = cfg.NoProxy
+	}
+	proxyFunc := proxyConfig.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}, nil
+}
@@ -0,0 +1,221 @@
+package httpclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-registration/config"
+)
+
+// testPKI holds a CA and the server and client certificates it issued.
+type testPKI struct {
+	dir        string
+	caPool     *x509.CertPool
+	caFile     string
+	serverCert tls.Certificate
+	clientCert string
+	clientKey  string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	dir, err := ioutil.TempDir("", "httpclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pki := &testPKI{dir: dir, caPool: x509.NewCertPool()}
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+	pki.caPool.AddCert(caCert)
+	pki.caFile = pki.write(t, "ca.pem", "CERTIFICATE", caDER)
+
+	issue := func(serial int64, usage x509.ExtKeyUsage) ([]byte, *ecdsa.PrivateKey) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "localhost"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der, key
+	}
+
+	serverDER, serverKey := issue(2, x509.ExtKeyUsageServerAuth)
+	pki.serverCert = tls.Certificate{Certificate: [][]byte{serverDER}, PrivateKey: serverKey}
+
+	clientDER, clientKey := issue(3, x509.ExtKeyUsageClientAuth)
+	clientKeyDER, _ := x509.MarshalECPrivateKey(clientKey)
+	pki.clientCert = pki.write(t, "client.pem", "CERTIFICATE", clientDER)
+	pki.clientKey = pki.write(t, "client-key.pem", "EC PRIVATE KEY", clientKeyDER)
+	return pki
+}
+
+func (pki *testPKI) write(t *testing.T, name, blockType string, der []byte) string {
+	file := filepath.Join(pki.dir, name)
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	defer os.RemoveAll(pki.dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{pki.serverCert},
+		ClientCAs:    pki.caPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	client, err := New(&config.HTTPClientConfig{
+		CAFiles:  []string{pki.caFile},
+		CertFile: pki.clientCert,
+		KeyFile:  pki.clientKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", resp.StatusCode)
+	}
+
+	// without the client certificate the server rejects the handshake
+	client, err = New(&config.HTTPClientConfig{
+		CAFiles: []string{pki.caFile},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := client.Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected the handshake to fail without a client certificate")
+	}
+}
+
+func TestNewSettings(t *testing.T) {
+	client, err := New(&config.HTTPClientConfig{
+		MinTLSVersion:       "1.3",
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 5,
+		MaxConnsPerHost:     20,
+		IdleConnTimeoutMs:   1000,
+		TimeoutMs:           2000,
+		Proxy: &config.ProxyConfig{
+			HTTPProxy: "http://proxy:3128",
+			NoProxy:   "kong",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Timeout != 2*time.Second {
+		t.Fatalf("unexpected timeout %s", client.Timeout)
+	}
+	transport := client.Transport.(*http.Transport)
+	if transport.TLSClientConfig.MinVersion != tls.VersionTLS13 {
+		t.Fatal("expected TLS 1.3")
+	}
+	if transport.MaxIdleConns != 10 || transport.MaxIdleConnsPerHost != 5 || transport.MaxConnsPerHost != 20 {
+		t.Fatal("unexpected connection pool settings")
+	}
+	if transport.IdleConnTimeout != time.Second {
+		t.Fatalf("unexpected idle timeout %s", transport.IdleConnTimeout)
+	}
+
+	proxied, _ := http.NewRequest(http.MethodGet, "http://example.com/users", nil)
+	if proxyURL, _ := transport.Proxy(proxied); proxyURL == nil || proxyURL.Host != "proxy:3128" {
+		t.Fatalf("expected the request to be proxied, got %v", proxyURL)
+	}
+	direct, _ := http.NewRequest(http.MethodGet, "http://kong/users", nil)
+	if proxyURL, _ := transport.Proxy(direct); proxyURL != nil {
+		t.Fatalf("expected no proxy for kong, got %v", proxyURL)
+	}
+}
+
+func TestNewProxyFromEnvironment(t *testing.T) {
+	for name, value := range map[string]string{"HTTP_PROXY": "http://env-proxy:3128", "HTTPS_PROXY": "http://env-proxy:3129", "NO_PROXY": ""} {
+		previous, ok := os.LookupEnv(name)
+		os.Setenv(name, value)
+		if ok {
+			defer os.Setenv(name, previous)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+	client, err := New(&config.HTTPClientConfig{Proxy: &config.ProxyConfig{NoProxy: "kong"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := client.Transport.(*http.Transport)
+
+	proxied, _ := http.NewRequest(http.MethodGet, "https://example.com/users", nil)
+	if proxyURL, _ := transport.Proxy(proxied); proxyURL == nil || proxyURL.Host != "env-proxy:3129" {
+		t.Fatalf("expected the proxy of the environment, got %v", proxyURL)
+	}
+	direct, _ := http.NewRequest(http.MethodGet, "https://kong/users", nil)
+	if proxyURL, _ := transport.Proxy(direct); proxyURL != nil {
+		t.Fatalf("expected no proxy for kong, got %v", proxyURL)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	cases := map[string]*config.HTTPClientConfig{
+		"unknown TLS version":       {MinTLSVersion: "2.0"},
+		"both certFile and keyFile": {CertFile: "client.pem"},
+		"CA bundle":                 {CAFiles: []string{"missing-ca.pem"}},
+		"client certificate":        {CertFile: "missing.pem", KeyFile: "missing-key.pem"},
+		"invalid proxy URL":         {Proxy: &config.ProxyConfig{HTTPSProxy: "http://[::1"}},
+	}
+	for expected, cfg := range cases {
+		_, err := New(cfg)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected %q error, got %v", expected, err)
+		}
+	}
+}
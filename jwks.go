@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/Microkubes/microservice-registration/app"
+	"github.com/Microkubes/microservice-registration/signer"
+	"github.com/keitaroinc/goa"
+)
+
+// JwksController implements the jwks resource.
+type JwksController struct {
+	*goa.Controller
+	Signer *signer.Signer
+}
+
+// NewJwksController creates a jwks controller publishing the keys of the given signer.
+func NewJwksController(service *goa.Service, jwtSigner *signer.Signer) *JwksController {
+	return &JwksController{
+		Controller: service.NewController("JwksController"),
+		Signer:     jwtSigner,
+	}
+}
+
+// Jwks runs the jwks action. It publishes the public keys that verify the self-signed
+// system tokens: the current system key, the configured previous keys and the recently
+// rotated out keys.
+func (c *JwksController) Jwks(ctx *app.JwksJwksContext) error {
+	keys, err := c.Signer.PublicKeys()
+	if err != nil {
+		goa.LogError(ctx, "Jwks: Failed to load the system key", "err", err.Error())
+		return ctx.InternalServerError(goa.ErrInternal(err))
+	}
+
+	res := &app.JWKSet{
+		Keys: []*app.JWK{},
+	}
+	for _, key := range keys {
+		res.Keys = append(res.Keys, &app.JWK{
+			Kty: key.Kty,
+			Kid: key.Kid,
+			Use: key.Use,
+			Alg: key.Alg,
+			N:   optional(key.N),
+			E:   optional(key.E),
+			Crv: optional(key.Crv),
+			X:   optional(key.X),
+			Y:   optional(key.Y),
+		})
+	}
+	return ctx.OK(res)
+}
+
+func optional(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
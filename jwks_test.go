@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Microkubes/microservice-registration/app/test"
+	"github.com/Microkubes/microservice-registration/signer"
+)
+
+func TestJwksOK(t *testing.T) {
+	jwksCtrl := NewJwksController(service, ctrl.Signer)
+
+	_, jwks := test.JwksJwksOK(t, context.Background(), service, jwksCtrl)
+
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("expected the system key only, got %d keys", len(jwks.Keys))
+	}
+	key := jwks.Keys[0]
+	if key.Kty != "RSA" || key.Alg != "RS256" || key.Use != "sig" {
+		t.Fatalf("unexpected key %+v", key)
+	}
+	if key.N == nil || key.E == nil || key.X != nil {
+		t.Fatal("expected the RSA key members only")
+	}
+}
+
+func TestJwksInternalServerError(t *testing.T) {
+	jwksCtrl := NewJwksController(service, signer.New("missing-system-key"))
+
+	test.JwksJwksInternalServerError(t, context.Background(), service, jwksCtrl)
+}
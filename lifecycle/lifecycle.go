@@ -0,0 +1,203 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// State is where a registration is in its lifecycle.
+type State string
+
+// Registration states.
+const (
+	// StatePending is a registration accepted but not processed yet.
+	StatePending State = "pending"
+	// StateUserCreated is a registration whose user was created by the user microservice.
+	StateUserCreated State = "user_created"
+	// StateProfileCreated is a registration whose user profile was created.
+	StateProfileCreated State = "profile_created"
+	// StateMailQueued is a registration whose verification email was published to the
+	// mail queue. There is no "mail sent" state: the mail microservice consumes the queue
+	// and does not report back whether it sent the email.
+	StateMailQueued State = "mail_queued"
+	// StateVerified is a registration whose user verified the email address, recorded by
+	// the verification flow.
+	StateVerified State = "verified"
+	// StateFailed is a registration that failed.
+	StateFailed State = "failed"
+)
+
+// transitions lists the states every state can move to. A verification email can be
+// queued again by a resend.
+var transitions = map[State][]State{
+	StatePending:        {StateUserCreated, StateFailed},
+	StateUserCreated:    {StateProfileCreated, StateFailed},
+	StateProfileCreated: {StateMailQueued, StateVerified, StateFailed},
+	StateMailQueued:     {StateMailQueued, StateVerified},
+	StateVerified:       {},
+	StateFailed:         {},
+}
+
+// ErrNotFound is returned when there is no registration with the given ID.
+var ErrNotFound = errors.New("registration not found")
+
+// ErrConflict is returned by Store.Update when the record was changed since it was read.
+var ErrConflict = errors.New("registration was changed concurrently")
+
+// Transition is a state change of a registration.
+type Transition struct {
+	State State     `json:"state" bson:"state"`
+	At    time.Time `json:"at" bson:"at"`
+	Error string    `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// Record is the persisted lifecycle of a registration.
+type Record struct {
+	ID        string       `json:"id" bson:"_id"`
+	UserID    string       `json:"userId,omitempty" bson:"userId,omitempty"`
+	State     State        `json:"state" bson:"state"`
+	Error     string       `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt time.Time    `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt" bson:"updatedAt"`
+	History   []Transition `json:"history" bson:"history"`
+	// Version is incremented by every update, for the optimistic locking of the stores.
+	Version int `json:"version" bson:"version"`
+}
+
+// CanMove reports whether the registration can move from state from to state to.
+func CanMove(from, to State) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Move moves the record to state to at the given time, recording cause as the error of a
+// failed registration.
+func (r *Record) Move(to State, cause error, at time.Time) error {
+	if !CanMove(r.State, to) {
+		return fmt.Errorf("registration %s cannot move from %s to %s", r.ID, r.State, to)
+	}
+	transition := Transition{State: to, At: at.UTC()}
+	if cause != nil {
+		transition.Error = cause.Error()
+		r.Error = transition.Error
+	}
+	r.State = to
+	r.UpdatedAt = transition.At
+	r.History = append(r.History, transition)
+	return nil
+}
+
+// Store persists the registration records.
+type Store interface {
+	// Create stores a new record.
+	Create(record *Record) error
+	// Get returns the record with the given ID, or ErrNotFound.
+	Get(id string) (*Record, error)
+	// FindByUserID returns the record of the user, or ErrNotFound.
+	FindByUserID(userID string) (*Record, error)
+	// FindStale returns the records in one of the states that were last updated before
+	// the given time.
+	FindStale(states []State, before time.Time) ([]*Record, error)
+	// Update replaces the record when its stored version is still record.Version and
+	// increments the version, or returns ErrConflict.
+	Update(record *Record) error
+	// Close releases the resources of the store.
+	Close() error
+}
+
+// maxConflicts is how many times a transition is retried on concurrent updates.
+const maxConflicts = 3
+
+// Tracker drives the registration records through the state machine.
+type Tracker struct {
+	Store Store
+
+	now func() time.Time
+}
+
+// NewTracker returns a Tracker persisting the records in store.
+func NewTracker(store Store) *Tracker {
+	return &Tracker{Store: store, now: time.Now}
+}
+
+// Start creates the record of a new, pending registration.
+func (t *Tracker) Start() (*Record, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	now := t.now().UTC()
+	record := &Record{
+		ID:        id.String(),
+		State:     StatePending,
+		CreatedAt: now,
+		UpdatedAt: now,
+		History:   []Transition{{State: StatePending, At: now}},
+	}
+	if err := t.Store.Create(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Move moves the registration with the given ID to state to, recording cause when the
+// registration failed. update, when not nil, changes the record along with the state.
+func (t *Tracker) Move(id string, to State, cause error, update func(*Record)) (*Record, error) {
+	for attempt := 1; ; attempt++ {
+		record, err := t.Store.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if err := record.Move(to, cause, t.now()); err != nil {
+			return nil, err
+		}
+		if update != nil {
+			update(record)
+		}
+		err = t.Store.Update(record)
+		if err == nil {
+			return record, nil
+		}
+		if err != ErrConflict || attempt == maxConflicts {
+			return nil, err
+		}
+	}
+}
+
+// orphanable are the states of a registration that is still being processed. A
+// registration that rests in profile_created did not ask for the verification email.
+var orphanable = []State{StatePending, StateUserCreated}
+
+// FailOrphans fails the registrations that are still being processed but were last
+// updated before the given time, recording cause. The payloads of the registrations are
+// not persisted, so a registration whose process stopped cannot complete. A record
+// updated while it is failed is skipped, as it is still processed. FailOrphans returns
+// the number of failed registrations.
+func (t *Tracker) FailOrphans(before time.Time, cause error) (int, error) {
+	records, err := t.Store.FindStale(orphanable, before)
+	if err != nil {
+		return 0, err
+	}
+	failed := 0
+	for _, record := range records {
+		if err := record.Move(StateFailed, cause, t.now()); err != nil {
+			return failed, err
+		}
+		err := t.Store.Update(record)
+		if err == ErrConflict {
+			continue
+		}
+		if err != nil {
+			return failed, err
+		}
+		failed++
+	}
+	return failed, nil
+}
@@ -0,0 +1,142 @@
+package lifecycle
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-registration/config"
+	commonconf "github.com/Microkubes/microservice-tools/config"
+)
+
+func TestTrackerStateMachine(t *testing.T) {
+	tracker := NewTracker(NewMemoryStore())
+	record, err := tracker.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.State != StatePending {
+		t.Fatalf("expected a pending registration, got %s", record.State)
+	}
+
+	if _, err := tracker.Move(record.ID, StateMailQueued, nil, nil); err == nil {
+		t.Fatal("expected the mail not to be queued before the user is created")
+	}
+	if _, err := tracker.Move(record.ID, StateUserCreated, nil, func(r *Record) { r.UserID = "5980" }); err != nil {
+		t.Fatal(err)
+	}
+	failed, err := tracker.Move(record.ID, StateFailed, errors.New("profile_service"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed.Error != "profile_service" || len(failed.History) != 3 || failed.History[2].Error != "profile_service" {
+		t.Fatalf("expected the failure in the record, got %+v", failed)
+	}
+	if _, err := tracker.Move(record.ID, StateProfileCreated, nil, nil); err == nil {
+		t.Fatal("expected a failed registration to be final")
+	}
+
+	found, err := tracker.Store.FindByUserID("5980")
+	if err != nil || found.ID != record.ID || found.Version != 2 {
+		t.Fatalf("expected the record of the user, got %+v, %v", found, err)
+	}
+	if _, err := tracker.Store.Get("unknown"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// conflictingStore fails the first updates with ErrConflict.
+type conflictingStore struct {
+	*MemoryStore
+	conflicts int
+}
+
+func (c *conflictingStore) Update(record *Record) error {
+	if c.conflicts > 0 {
+		c.conflicts--
+		return ErrConflict
+	}
+	return c.MemoryStore.Update(record)
+}
+
+func TestTrackerRetriesConflicts(t *testing.T) {
+	store := &conflictingStore{MemoryStore: NewMemoryStore(), conflicts: maxConflicts - 1}
+	tracker := NewTracker(store)
+	record, err := tracker.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tracker.Move(record.ID, StateUserCreated, nil, nil); err != nil {
+		t.Fatalf("expected the transition to be retried, got %v", err)
+	}
+
+	store.conflicts = maxConflicts
+	if _, err := tracker.Move(record.ID, StateProfileCreated, nil, nil); err != ErrConflict {
+		t.Fatalf("expected ErrConflict once the retries are exhausted, got %v", err)
+	}
+}
+
+func TestFailOrphans(t *testing.T) {
+	tracker := NewTracker(NewMemoryStore())
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return start }
+
+	pending, _ := tracker.Start()
+	created, _ := tracker.Start()
+	tracker.Move(created.ID, StateUserCreated, nil, nil)
+	resting, _ := tracker.Start()
+	tracker.Move(resting.ID, StateUserCreated, nil, nil)
+	tracker.Move(resting.ID, StateProfileCreated, nil, nil)
+	tracker.now = func() time.Time { return start.Add(time.Hour) }
+	recent, _ := tracker.Start()
+
+	failed, err := tracker.FailOrphans(start.Add(time.Minute), errors.New("shutdown"))
+	if err != nil || failed != 2 {
+		t.Fatalf("expected 2 failed registrations, got %d, %v", failed, err)
+	}
+	for id, expected := range map[string]State{
+		pending.ID: StateFailed,
+		created.ID: StateFailed,
+		resting.ID: StateProfileCreated,
+		recent.ID:  StatePending,
+	} {
+		record, _ := tracker.Store.Get(id)
+		if record.State != expected {
+			t.Fatalf("expected %s, got %+v", expected, record)
+		}
+	}
+	if record, _ := tracker.Store.Get(pending.ID); record.Error != "shutdown" {
+		t.Fatalf("expected the cause in the record, got %+v", record)
+	}
+}
+
+func TestMemoryStoreVersion(t *testing.T) {
+	store := NewMemoryStore()
+	record := &Record{ID: "r1", State: StatePending}
+	store.Create(record)
+
+	stale, _ := store.Get("r1")
+	current, _ := store.Get("r1")
+	current.State = StateUserCreated
+	if err := store.Update(current); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Update(stale); err != ErrConflict {
+		t.Fatalf("expected the stale update to conflict, got %v", err)
+	}
+}
+
+func TestOpenStore(t *testing.T) {
+	for _, cfg := range []*commonconf.DBConfig{nil, {DBName: config.DatabaseMemory}} {
+		store, err := OpenStore(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := store.(*MemoryStore); !ok {
+			t.Fatalf("expected the memory store, got %T", store)
+		}
+	}
+	if _, err := OpenStore(&commonconf.DBConfig{DBName: "dynamodb"}); err == nil {
+		t.Fatal("expected an error for an unknown database")
+	}
+}
@@ -0,0 +1,96 @@
+package lifecycle
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the records in memory. The records are lost on restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]*Record
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]*Record{}}
+}
+
+// Create stores a new record.
+func (m *MemoryStore) Create(record *Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[record.ID] = copyRecord(record)
+	return nil
+}
+
+// Get returns the record with the given ID.
+func (m *MemoryStore) Get(id string) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyRecord(record), nil
+}
+
+// FindByUserID returns the latest record of the user.
+func (m *MemoryStore) FindByUserID(userID string) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var found *Record
+	for _, record := range m.records {
+		if record.UserID == userID && userID != "" && (found == nil || record.CreatedAt.After(found.CreatedAt)) {
+			found = record
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return copyRecord(found), nil
+}
+
+// FindStale returns the records in one of the states last updated before the given time.
+func (m *MemoryStore) FindStale(states []State, before time.Time) ([]*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	found := []*Record{}
+	for _, record := range m.records {
+		for _, state := range states {
+			if record.State == state && record.UpdatedAt.Before(before) {
+				found = append(found, copyRecord(record))
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+// Update replaces the record when its version did not change.
+func (m *MemoryStore) Update(record *Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.records[record.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != record.Version {
+		return ErrConflict
+	}
+	record.Version++
+	m.records[record.ID] = copyRecord(record)
+	return nil
+}
+
+// Close does nothing.
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// copyRecord copies the record, so the callers cannot change the stored records.
+func copyRecord(record *Record) *Record {
+	c := *record
+	c.History = append([]Transition{}, record.History...)
+	return &c
+}
@@ -0,0 +1,136 @@
+package lifecycle
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Microkubes/microservice-registration/config"
+	commonconf "github.com/Microkubes/microservice-tools/config"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Collection is the MongoDB collection of the registration records.
+const Collection = "registrations"
+
+// mongoDialTimeout is the timeout of the connection to MongoDB.
+const mongoDialTimeout = 10 * time.Second
+
+// MongoStore stores the records in a MongoDB collection.
+type MongoStore struct {
+	session    *mgo.Session
+	database   string
+	collection string
+}
+
+// NewMongoStore connects to MongoDB and ensures the index on the user ID.
+func NewMongoStore(info commonconf.DBInfo) (*MongoStore, error) {
+	session, err := mgo.DialWithInfo(&mgo.DialInfo{
+		Addrs:    []string{info.Host},
+		Username: info.Username,
+		Password: info.Password,
+		Database: info.DatabaseName,
+		Timeout:  mongoDialTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	session.SetMode(mgo.Monotonic, true)
+	store := &MongoStore{session: session, database: info.DatabaseName, collection: Collection}
+
+	s, c := store.c()
+	defer s.Close()
+	if err := c.EnsureIndex(mgo.Index{Key: []string{"userId"}, Background: true}); err != nil {
+		session.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// c returns a copy of the session, which must be closed, and the collection.
+func (m *MongoStore) c() (*mgo.Session, *mgo.Collection) {
+	session := m.session.Copy()
+	return session, session.DB(m.database).C(m.collection)
+}
+
+// Create stores a new record.
+func (m *MongoStore) Create(record *Record) error {
+	s, c := m.c()
+	defer s.Close()
+	return c.Insert(record)
+}
+
+// Get returns the record with the given ID.
+func (m *MongoStore) Get(id string) (*Record, error) {
+	return m.findOne(bson.M{"_id": id})
+}
+
+// FindByUserID returns the latest record of the user.
+func (m *MongoStore) FindByUserID(userID string) (*Record, error) {
+	return m.findOne(bson.M{"userId": userID})
+}
+
+// FindStale returns the records in one of the states last updated before the given time.
+func (m *MongoStore) FindStale(states []State, before time.Time) ([]*Record, error) {
+	s, c := m.c()
+	defer s.Close()
+	records := []*Record{}
+	err := c.Find(bson.M{"state": bson.M{"$in": states}, "updatedAt": bson.M{"$lt": before}}).All(&records)
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (m *MongoStore) findOne(query bson.M) (*Record, error) {
+	s, c := m.c()
+	defer s.Close()
+	record := &Record{}
+	err := c.Find(query).Sort("-createdAt").One(record)
+	if err == mgo.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Update replaces the record when its version did not change.
+func (m *MongoStore) Update(record *Record) error {
+	s, c := m.c()
+	defer s.Close()
+	updated := *record
+	updated.Version++
+	err := c.Update(bson.M{"_id": record.ID, "version": record.Version}, &updated)
+	if err == mgo.ErrNotFound {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	record.Version = updated.Version
+	return nil
+}
+
+// Close closes the MongoDB session.
+func (m *MongoStore) Close() error {
+	m.session.Close()
+	return nil
+}
+
+// OpenStore opens the store configured by database.dbName: the MemoryStore when the
+// database is not configured.
+func OpenStore(cfg *commonconf.DBConfig) (Store, error) {
+	if cfg == nil {
+		return NewMemoryStore(), nil
+	}
+	switch cfg.DBName {
+	case "", config.DatabaseMemory:
+		return NewMemoryStore(), nil
+	case config.DatabaseMongo:
+		return NewMongoStore(cfg.DBInfo)
+	default:
+		return nil, fmt.Errorf("unknown database %q", cfg.DBName)
+	}
+}
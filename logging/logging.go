@@ -0,0 +1,205 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Microkubes/microservice-registration/config"
+	"github.com/keitaroinc/goa"
+)
+
+// Level is the severity of a log record.
+type Level int
+
+// Log levels.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel returns the level named s ("debug", "info", "warn" or "error").
+func ParseLevel(s string) (Level, error) {
+	for level, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(level), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// output is the destination shared by a logger and the loggers derived from it.
+type output struct {
+	mu       sync.Mutex
+	w        io.Writer
+	level    Level
+	redactor *Redactor
+	now      func() time.Time
+}
+
+// Logger writes the log records as JSON lines: the time, level and message followed by the
+// context fields of the logger and the fields of the record. Logger implements
+// goa.LogAdapter, so the request ID and the controller and action names set by goa end
+// up in the records logged during a request.
+type Logger struct {
+	out     *output
+	keyvals []interface{}
+}
+
+// New returns a Logger writing to w. The emails, JWTs, credentials and the values of the
+// sensitive fields (passwords, tokens, secrets) are redacted unless disabled in cfg.
+func New(w io.Writer, cfg *config.LoggingConfig) (*Logger, error) {
+	level, err := ParseLevel(cfg.LogLevel())
+	if err != nil {
+		return nil, err
+	}
+	out := &output{w: w, level: level, now: time.Now}
+	if cfg == nil || !cfg.DisableRedaction {
+		var keys []string
+		if cfg != nil {
+			keys = cfg.RedactKeys
+		}
+		out.redactor = NewRedactor(keys...)
+	}
+	return &Logger{out: out}, nil
+}
+
+// Debug logs a debug message.
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, msg, keyvals)
+}
+
+// Info logs an informational message.
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, msg, keyvals)
+}
+
+// Warn logs a warning.
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(LevelWarn, msg, keyvals)
+}
+
+// Error logs an error.
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
+}
+
+// New returns a logger with the keyvals appended to the context fields.
+func (l *Logger) New(keyvals ...interface{}) goa.LogAdapter {
+	return l.With(keyvals...)
+}
+
+// With returns a logger with the keyvals appended to the context fields.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	if len(keyvals) == 0 {
+		return l
+	}
+	kvs := append(l.keyvals, keyvals...)
+	if len(kvs)%2 != 0 {
+		kvs = append(kvs, goa.ErrMissingLogValue)
+	}
+	// Limiting the capacity makes the loggers derived from l append to their own arrays.
+	return &Logger{out: l.out, keyvals: kvs[:len(kvs):len(kvs)]}
+}
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if level < l.out.level {
+		return
+	}
+	if len(keyvals)%2 != 0 {
+		keyvals = append(keyvals, goa.ErrMissingLogValue)
+	}
+
+	var record bytes.Buffer
+	record.WriteString(`{"time":`)
+	record.Write(l.encode("", l.out.now().UTC().Format(time.RFC3339Nano)))
+	record.WriteString(`,"level":`)
+	record.Write(l.encode("", level.String()))
+	record.WriteString(`,"msg":`)
+	record.Write(l.encode("", msg))
+	for _, kvs := range [][]interface{}{l.keyvals, keyvals} {
+		for i := 0; i < len(kvs); i += 2 {
+			key := fmt.Sprint(kvs[i])
+			record.WriteByte(',')
+			record.Write(l.encode("", key))
+			record.WriteByte(':')
+			record.Write(l.encode(key, kvs[i+1]))
+		}
+	}
+	record.WriteString("}\n")
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(record.Bytes())
+}
+
+// encode returns the JSON encoding of the value of the field key, redacted.
+func (l *Logger) encode(key string, value interface{}) []byte {
+	redactor := l.out.redactor
+	if redactor != nil && key != "" && redactor.SensitiveKey(key) && value != nil {
+		value = Redacted
+	}
+
+	switch v := value.(type) {
+	case string:
+		value = l.redact(v)
+	case error:
+		value = l.redact(v.Error())
+	case fmt.Stringer:
+		value = l.redact(v.String())
+	case nil, bool, int, int32, int64, uint, uint32, uint64, float32, float64:
+	default:
+		js, err := json.Marshal(v)
+		if err != nil {
+			value = l.redact(fmt.Sprintf("%+v", v))
+			break
+		}
+		if redacted := []byte(l.redact(string(js))); json.Valid(redacted) {
+			return redacted
+		}
+		value = l.redact(string(js))
+	}
+
+	js, err := json.Marshal(value)
+	if err != nil {
+		js, _ = json.Marshal(fmt.Sprintf("%+v", value))
+	}
+	return js
+}
+
+func (l *Logger) redact(s string) string {
+	if l.out.redactor == nil {
+		return s
+	}
+	return l.out.redactor.String(s)
+}
+
+// Debug logs a debug message with the logger of the request context.
+func Debug(ctx context.Context, msg string, keyvals ...interface{}) {
+	if logger, ok := goa.ContextLogger(ctx).(*Logger); ok {
+		logger.Debug(msg, keyvals...)
+	}
+}
+
+// Warn logs a warning with the logger of the request context. Loggers that have no warning
+// level log it as an informational message.
+func Warn(ctx context.Context, msg string, keyvals ...interface{}) {
+	if logger, ok := goa.ContextLogger(ctx).(*Logger); ok {
+		logger.Warn(msg, keyvals...)
+		return
+	}
+	goa.LogInfo(ctx, msg, keyvals...)
+}
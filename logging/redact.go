@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces the values of the sensitive fields.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are the parts of the field names whose values are always redacted.
+var sensitiveKeys = []string{"password", "passwd", "secret", "token", "authorization", "cookie", "apikey", "api_key", "privatekey"}
+
+var (
+	// jsonSecret matches the sensitive properties in a JSON document, such as a logged payload.
+	jsonSecret = regexp.MustCompile(`(?i)("[a-z_-]*(?:password|passwd|secret|token|authorization|api_?key)[a-z_-]*"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	// querySecret matches the sensitive URL query parameters and key=value pairs.
+	querySecret = regexp.MustCompile(`(?i)\b([a-z_-]*(?:password|passwd|secret|token|api_?key)[a-z_-]*=)[^&\s"]+`)
+	// credentials matches the credentials of an Authorization header.
+	credentials = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`)
+	// jwt matches a JSON Web Token (compact serialization).
+	jwt = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	// email matches an email address, keeping its first character and domain.
+	email = regexp.MustCompile(`([A-Za-z0-9._%+-])[A-Za-z0-9._%+-]*@([A-Za-z0-9.-]+\.[A-Za-z]{2,})`)
+)
+
+// Redactor masks the personal data and the credentials in the log records.
+type Redactor struct {
+	keys []string
+}
+
+// NewRedactor returns a Redactor that redacts the values of the default sensitive fields
+// and of the fields named in keys.
+func NewRedactor(keys ...string) *Redactor {
+	redactor := &Redactor{keys: append([]string{}, sensitiveKeys...)}
+	for _, key := range keys {
+		redactor.keys = append(redactor.keys, strings.ToLower(key))
+	}
+	return redactor
+}
+
+// SensitiveKey reports whether the values of the field are always redacted.
+func (r *Redactor) SensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range r.keys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// String masks the emails, JWTs, credentials and secret properties found in s.
+func (r *Redactor) String(s string) string {
+	s = jsonSecret.ReplaceAllString(s, `$1"`+Redacted+`"`)
+	s = querySecret.ReplaceAllString(s, "${1}"+Redacted)
+	s = credentials.ReplaceAllString(s, "$1 "+Redacted)
+	s = jwt.ReplaceAllString(s, Redacted)
+	return email.ReplaceAllString(s, "$1***@$2")
+}
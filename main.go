@@ -3,13 +3,30 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/Microkubes/microservice-registration/admin"
 	"github.com/Microkubes/microservice-registration/app"
+	"github.com/Microkubes/microservice-registration/audit"
+	"github.com/Microkubes/microservice-registration/certificate"
 	"github.com/Microkubes/microservice-registration/config"
-	"github.com/Microkubes/microservice-tools/gateway"
-	"github.com/Microkubes/microservice-tools/utils/healthcheck"
+	"github.com/Microkubes/microservice-registration/httpclient"
+	"github.com/Microkubes/microservice-registration/lifecycle"
+	"github.com/Microkubes/microservice-registration/logging"
+	"github.com/Microkubes/microservice-registration/metrics"
+	"github.com/Microkubes/microservice-registration/readiness"
+	"github.com/Microkubes/microservice-registration/registrar"
+	"github.com/Microkubes/microservice-registration/resilience"
+	"github.com/Microkubes/microservice-registration/tracing"
+	"github.com/Microkubes/microservice-tools/rabbitmq"
 	"github.com/Microkubes/microservice-tools/utils/version"
 	"github.com/keitaroinc/goa"
 	"github.com/keitaroinc/goa/middleware"
@@ -18,32 +35,91 @@ import (
 func main() {
 	// Create service
 	service := goa.New("user")
+	// Log JSON records with the personal data redacted, at the configured level once the
+	// configuration is loaded
+	logger, _ := logging.New(os.Stdout, nil)
+	service.WithLogger(logger)
 
 	cf := os.Getenv("SERVICE_CONFIG_FILE")
 	if cf == "" {
 		cf = "/run/secrets/microservice_registration_config.json"
+		if _, err := os.Stat(cf); os.IsNotExist(err) {
+			// configured from the defaults and the environment only
+			cf = ""
+		}
 	}
-	cfg, err := config.LoadConfig(cf)
+	configFormat := flag.String("config-format", os.Getenv("SERVICE_CONFIG_FORMAT"),
+		"format of the configuration file: json, yaml or toml (detected by the file extension when not set)")
+	flag.Parse()
+
+	format := config.FormatOf(cf)
+	if *configFormat != "" {
+		f, err := config.ParseFormat(*configFormat)
+		if err != nil {
+			service.LogError("config", "err", err)
+			panic(err)
+		}
+		format = f
+	}
+	cfg, err := config.LoadFormat(cf, format)
 	if err != nil {
 		service.LogError("config", "err", err)
 		panic(err)
 	}
+	if err := cfg.Validate(); err != nil {
+		service.LogError("config", "err", err)
+		panic(err)
+	}
+	if logger, err = logging.New(os.Stdout, cfg.Logging); err != nil {
+		service.LogError("logging", "err", err)
+		panic(err)
+	}
+	service.WithLogger(logger)
+	service.LogInfo("config", "effective", cfg.String())
+
+	resilience.Configure(cfg.Resilience)
 
-	registration := gateway.NewKongGateway(cfg.GatewayAdminURL, &http.Client{}, &cfg.Microservice)
-	err = registration.SelfRegister()
+	shutdownTracing, err := tracing.Setup(cfg.Tracing, cfg.Microservice.MicroserviceName, cfg.Version)
 	if err != nil {
+		service.LogError("tracing", "err", err)
 		panic(err)
 	}
 
-	defer registration.Unregister() // defer the unregister for after main exits
+	if cfg.Messaging.DeclareQueues {
+		if err := DeclareRoutes(cfg); err != nil {
+			service.LogError("messaging", "err", err)
+			panic(err)
+		}
+	}
+
+	client, err := httpclient.New(cfg.HTTPClient)
+	if err != nil {
+		service.LogError("http client", "err", err)
+		panic(err)
+	}
+	client.Transport = tracing.Transport(client.Transport)
+
+	// Register on the API Gateway in the background, so that the service starts while the
+	// gateway is unavailable. The admin API is not called with the client of the downstream
+	// services, which presents their client certificate and goes through their proxy.
+	gatewayRegistration, err := registrar.New(cfg, http.DefaultClient)
+	if err != nil {
+		service.LogError("gateway registration", "err", err)
+		panic(err)
+	}
+	registration := registrar.NewRegistration(cfg.Gateway.RegistrarType(), gatewayRegistration, cfg.Gateway)
+	go registration.Run(func(err error, retryIn time.Duration) {
+		service.LogError("gateway registration failed", "err", err, "retryIn", retryIn.String())
+	})
 
 	// Mount middleware
+	service.Use(tracing.Middleware())
 	service.Use(middleware.RequestID())
 	service.Use(middleware.LogRequest(true))
 	service.Use(middleware.ErrorHandler(service, true))
 	service.Use(middleware.Recover())
 
-	service.Use(healthcheck.NewCheckMiddleware("/healthcheck"))
+	service.Use(registrar.NewCheckMiddleware("/healthcheck", registration))
 
 	service.Use(version.NewVersionMiddleware(cfg.Version, "/version"))
 
@@ -51,16 +127,187 @@ func main() {
 	c := NewSwaggerController(service)
 	app.MountSwaggerController(service, c)
 	// Mount "user" controller
+	store := config.NewStore(cfg)
 	c2 := NewUserController(
 		service,
-		cfg,
+		store,
 		CreateRabbitmqChannel,
-		&http.Client{},
+		client,
 	)
 	app.MountUserController(service, c2)
 
-	// Start service
-	if err := service.ListenAndServe(":8080"); err != nil {
-		service.LogError("startup", "err", err)
+	// Keep the registration records in the configured database
+	registrations, err := lifecycle.OpenStore(cfg.Database)
+	if err != nil {
+		service.LogError("registration store", "err", err)
+		panic(err)
+	}
+	c2.Tracker = lifecycle.NewTracker(registrations)
+	// The payloads of the registrations are not persisted, so the registrations left
+	// unfinished by the previous process cannot complete
+	orphans, err := c2.Tracker.FailOrphans(time.Now().Add(-cfg.Async.OrphanAge()), errors.New(metrics.ErrorShutdown))
+	if err != nil {
+		service.LogError("registration store: failing the unfinished registrations", "err", err)
+	} else if orphans > 0 {
+		service.LogInfo("registration store: failed the unfinished registrations", "count", orphans)
+	}
+
+	// Process the asynchronous registrations on a pool of workers
+	c2.Async = NewAsyncRegistrar(c2, cfg.Async)
+
+	// Record the registrations, resent verifications and admin actions in the audit log
+	dialAudit := func() (rabbitmq.Channel, func() error, error) {
+		conn, ch, err := CreateRabbitmqChannel(store.Get())
+		if err != nil {
+			return nil, nil, err
+		}
+		return ch, conn.Close, nil
+	}
+	auditSink, err := audit.OpenSink(cfg.Audit, dialAudit)
+	if err != nil {
+		service.LogError("audit log", "err", err)
+		panic(err)
+	}
+	auditLog := audit.New(auditSink)
+	c2.Audit = auditLog
+	onAuditError := func(err error) {
+		service.LogError("audit log", "err", err)
+	}
+	// Mount "jwks" controller
+	c3 := NewJwksController(service, c2.Signer)
+	app.MountJwksController(service, c3)
+
+	// Load the system key and reload it when it is rotated
+	if err := c2.Signer.Load(); err != nil {
+		service.LogError("system key", "err", err)
+		panic(err)
+	}
+	if err := c2.Signer.LoadPublished(cfg.PreviousSystemKeys); err != nil {
+		service.LogError("previous system keys", "err", err)
+		panic(err)
+	}
+	// Check the dependencies on /readiness; /liveness only reports that the service is up
+	checker := NewReadinessChecker(store, CreateRabbitmqChannel, client, c2.Signer)
+	service.Use(readiness.NewMiddleware("/readiness", "/liveness", checker))
+
+	stopKeyWatch := make(chan struct{})
+	defer close(stopKeyWatch)
+	go c2.Signer.Watch(10*time.Second, stopKeyWatch, func(err error) {
+		service.LogError("system key reload", "err", err)
+	})
+
+	// Reload the configuration when the file changes or on SIGHUP
+	if cf != "" {
+		reloader := config.NewReloader(store, cf, format, func(next *config.Config, changes []config.Change) {
+			resilience.Configure(next.Resilience)
+			changed := []string{}
+			for _, change := range changes {
+				changed = append(changed, change.String())
+			}
+			service.LogInfo("config reloaded", "changes", strings.Join(changed, ", "))
+			err := auditLog.Record(audit.Event{
+				Type:    audit.ConfigReloaded,
+				Details: map[string]string{"changes": strings.Join(changed, ", ")},
+			})
+			if err != nil {
+				onAuditError(err)
+			}
+		})
+		onReloadError := func(err error) {
+			service.LogError("config reload rejected, keeping the current configuration", "err", err)
+			if err := auditLog.Record(audit.Event{Type: audit.ConfigReloadRejected, Reason: err.Error()}); err != nil {
+				onAuditError(err)
+			}
+		}
+		stopConfigWatch := make(chan struct{})
+		defer close(stopConfigWatch)
+		go reloader.Watch(10*time.Second, stopConfigWatch, onReloadError)
+
+		hangup := make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+		go func() {
+			for range hangup {
+				if _, err := reloader.Reload(); err != nil {
+					onReloadError(err)
+				}
+			}
+		}()
+	}
+
+	// Start the admin listener
+	adminServer := admin.NewServer(cfg.Admin)
+	hystrixStream := resilience.Mount(adminServer.Mux)
+	adminServer.Mux.Handle("/healthcheck", registrar.Handler(registration))
+	adminServer.Mux.Handle("/readiness", readiness.Handler(checker))
+	adminServer.Mux.Handle("/liveness", readiness.LivenessHandler())
+	adminServer.Mux.Handle("/config", admin.ConfigHandler(store))
+	adminServer.Mux.Handle("/metrics", metrics.Handler())
+	admin.MountPprof(adminServer.Mux)
+	adminServer.Use(func(h http.Handler) http.Handler {
+		return audit.Handler(auditLog, h, onAuditError, "/healthcheck", "/readiness", "/liveness", "/metrics")
+	})
+	go func() {
+		service.LogInfo("admin", "addr", adminServer.Addr())
+		if err := adminServer.ListenAndServe(); err != nil {
+			service.LogError("admin", "err", err)
+		}
+	}()
+
+	// Start service, on HTTPS when a certificate is configured
+	listen := func() error {
+		return service.ListenAndServe(cfg.ListenAddress())
+	}
+	if cfg.Server != nil && cfg.Server.TLS != nil {
+		cert := certificate.New(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
+		if err := cert.Load(); err != nil {
+			service.LogError("server certificate", "err", err)
+			panic(err)
+		}
+		stopCertWatch := make(chan struct{})
+		defer close(stopCertWatch)
+		go cert.Watch(10*time.Second, stopCertWatch, func(err error) {
+			service.LogError("server certificate reload", "err", err)
+		})
+		service.Server.TLSConfig = cert.TLSConfig()
+		listen = func() error {
+			// the certificate comes from TLSConfig.GetCertificate
+			return service.ListenAndServeTLS(cfg.ListenAddress(), "", "")
+		}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		if err := listen(); err != nil && err != http.ErrServerClosed {
+			service.LogError("startup", "err", err)
+		}
+	}()
+
+	// Unregister from the gateway, drain the in-flight requests and close the AMQP
+	// connections on SIGTERM/SIGINT, or when the listener fails
+	closeAudit := func() {
+		if err := auditLog.Close(); err != nil {
+			onAuditError(err)
+		}
+	}
+	closeRegistrations := func() {
+		if err := registrations.Close(); err != nil {
+			service.LogError("registration store", "err", err)
+		}
+	}
+	flushTracing := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			service.LogError("tracing shutdown", "err", err)
+		}
+	}
+	shutdown := &Shutdown{
+		Service:     service,
+		GracePeriod: cfg.Shutdown.GracePeriod(),
+		Unregister:  registration.Unregister,
+		Listeners:   []listener{adminServer},
+		Drain:       []func(context.Context) error{c2.Async.Close},
+		Close:       []func(){c2.CloseAmqpConnections, hystrixStream.Stop, closeAudit, closeRegistrations, flushTracing},
 	}
+	shutdown.RunOnSignal(stopped)
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Microkubes/microservice-registration/config"
+	"github.com/Microkubes/microservice-registration/metrics"
+	"github.com/Microkubes/microservice-registration/tracing"
+	"github.com/Microkubes/microservice-tools/rabbitmq"
+	"github.com/streadway/amqp"
+)
+
+// publisher is implemented by the channels that can publish with a routing key and message
+// headers, such as *rabbitmq.AMQPChannel.
+type publisher interface {
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+}
+
+// publish sends a message of the given kind along the route. Messages without an exchange
+// go through the default exchange straight to the route queue. The queue or the exchange
+// is declared first: the broker drops a message published to an exchange that does not
+// exist without reporting it. The trace context of ctx is sent in the message headers.
+func publish(ctx context.Context, ch rabbitmq.Channel, kind string, route config.RouteConfig, body []byte) (err error) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "amqp.publish "+kind)
+	defer func() {
+		tracing.End(span, err)
+		metrics.ObservePublish(kind, start, err)
+	}()
+
+	p, ok := ch.(publisher)
+	if !ok {
+		if route.Exchange == "" {
+			return ch.Send(route.Queue, body)
+		}
+		if route.RoutingKey != "" {
+			return fmt.Errorf("the channel cannot publish the %s message with the routing key %q", kind, route.RoutingKey)
+		}
+		return ch.SendToExchange(route.Exchange, route.ExchangeType, body)
+	}
+
+	msg := amqp.Publishing{
+		Headers:      amqp.Table{},
+		ContentType:  "text/plain",
+		DeliveryMode: amqp.Persistent,
+		Body:         body,
+	}
+	tracing.InjectAMQP(ctx, msg.Headers)
+	if route.Exchange == "" {
+		if _, err := p.QueueDeclare(route.Queue, true, false, false, false, nil); err != nil {
+			return err
+		}
+		return p.Publish("", route.Queue, false, false, msg)
+	}
+	if err := p.ExchangeDeclare(route.Exchange, route.ExchangeType, true, false, false, false, nil); err != nil {
+		return err
+	}
+	return p.Publish(route.Exchange, route.RoutingKey, false, false, msg)
+}
+
+// DeclareRoutes declares the queues and exchanges of all message routes and binds the
+// queues to the exchanges with the routing keys.
+func DeclareRoutes(cfg *config.Config) error {
+	conn, ch, err := CreateRabbitmqChannel(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	channel := ch.(*rabbitmq.AMQPChannel).Channel
+
+	for kind := range config.DefaultRoutes() {
+		route := cfg.Messaging.Route(kind)
+		if route.Queue != "" {
+			if _, err := channel.QueueDeclare(route.Queue, true, false, false, false, nil); err != nil {
+				return err
+			}
+		}
+		if route.Exchange == "" {
+			continue
+		}
+		if err := channel.ExchangeDeclare(route.Exchange, route.ExchangeType, true, false, false, false, nil); err != nil {
+			return err
+		}
+		if route.Queue != "" {
+			if err := channel.QueueBind(route.Queue, route.RoutingKey, route.Exchange, false, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// openAmqpChannel opens an AMQP channel and keeps track of its connection until it is
+// closed with closeAmqpConnection.
+func (c *UserController) openAmqpChannel(cfg *config.Config) (*amqp.Connection, rabbitmq.Channel, error) {
+	conn, ch, err := c.createAmqpChannel(cfg)
+	if err != nil || conn == nil {
+		return conn, ch, err
+	}
+	c.amqpMu.Lock()
+	defer c.amqpMu.Unlock()
+	c.amqpConns[conn] = true
+	return conn, ch, nil
+}
+
+// closeAmqpConnection closes a connection opened with openAmqpChannel.
+func (c *UserController) closeAmqpConnection(conn *amqp.Connection) {
+	if conn == nil {
+		return
+	}
+	c.amqpMu.Lock()
+	delete(c.amqpConns, conn)
+	c.amqpMu.Unlock()
+	if err := conn.Close(); err != nil && err != amqp.ErrClosed {
+		c.Service.LogError("AMQP connection close", "err", err)
+	}
+}
+
+// CloseAmqpConnections closes the AMQP connections of the requests that are still running,
+// once the shutdown grace period is over.
+func (c *UserController) CloseAmqpConnections() {
+	c.amqpMu.Lock()
+	conns := c.amqpConns
+	c.amqpConns = map[*amqp.Connection]bool{}
+	c.amqpMu.Unlock()
+	for conn := range conns {
+		if err := conn.Close(); err != nil && err != amqp.ErrClosed {
+			c.Service.LogError("AMQP connection close", "err", err)
+		}
+	}
+}
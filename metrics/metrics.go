@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registration outcomes.
+const (
+	// OutcomeSuccess is a completed registration or resent verification email.
+	OutcomeSuccess = "success"
+	// OutcomeRejected is a request rejected with 400 Bad Request.
+	OutcomeRejected = "rejected"
+	// OutcomeFailure is a request that failed with 500 Internal Server Error.
+	OutcomeFailure = "failure"
+)
+
+// Error classes of the failed registrations.
+const (
+	// ErrorNone is the error class of the successful registrations.
+	ErrorNone = "none"
+	// ErrorInvalidPayload means that the payload could not be processed.
+	ErrorInvalidPayload = "invalid_payload"
+	// ErrorUserRejected means that the user microservice rejected the user (400).
+	ErrorUserRejected = "user_rejected"
+	// ErrorUserService means that the user microservice failed.
+	ErrorUserService = "user_service"
+	// ErrorProfileRejected means that the user profile microservice rejected the profile (400).
+	ErrorProfileRejected = "profile_rejected"
+	// ErrorProfileService means that the user profile microservice failed.
+	ErrorProfileService = "profile_service"
+	// ErrorCircuitOpen means that the call was not made because the circuit breaker is open.
+	ErrorCircuitOpen = "circuit_open"
+	// ErrorTimeout means that a downstream call timed out.
+	ErrorTimeout = "timeout"
+	// ErrorMaxConcurrency means that a downstream call was rejected by the circuit breaker
+	// because too many calls were running.
+	ErrorMaxConcurrency = "max_concurrency"
+	// ErrorNetwork means that a downstream service could not be reached.
+	ErrorNetwork = "network"
+	// ErrorMessaging means that the email message could not be published.
+	ErrorMessaging = "messaging"
+	// ErrorQueueFull means that an asynchronous registration was not accepted because the
+	// queue of accepted registrations is full.
+	ErrorQueueFull = "queue_full"
+	// ErrorShutdown means that an asynchronous registration was stopped by the shutdown.
+	ErrorShutdown = "shutdown"
+	// ErrorInternal is any other error.
+	ErrorInternal = "internal"
+)
+
+var (
+	// Registrations counts the registrations by outcome and error class.
+	Registrations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "registration",
+		Name:      "registrations_total",
+		Help:      "Registrations by outcome and error class.",
+	}, []string{"outcome", "error_class"})
+
+	// ResendVerifications counts the resend verification requests by outcome.
+	ResendVerifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "registration",
+		Name:      "resend_verifications_total",
+		Help:      "Resend verification email requests by outcome.",
+	}, []string{"outcome"})
+
+	// DownstreamDuration observes the latency of the downstream calls per hystrix command.
+	DownstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "registration",
+		Name:      "downstream_request_duration_seconds",
+		Help:      "Latency of the calls to the downstream services per hystrix command and status class.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"command", "status"})
+
+	// PublishDuration observes the latency of the AMQP publishes per message kind.
+	PublishDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "registration",
+		Name:      "amqp_publish_duration_seconds",
+		Help:      "Latency of the AMQP publishes per message kind.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"kind"})
+
+	// PublishFailures counts the failed AMQP publishes per message kind.
+	PublishFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "registration",
+		Name:      "amqp_publish_failures_total",
+		Help:      "Failed AMQP publishes per message kind.",
+	}, []string{"kind"})
+
+	// InFlight is the number of requests being handled per action.
+	InFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "registration",
+		Name:      "in_flight_requests",
+		Help:      "Requests being handled per action.",
+	}, []string{"action"})
+
+	// AsyncQueued is the number of accepted registrations waiting for a worker.
+	AsyncQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "registration",
+		Name:      "async_queued_registrations",
+		Help:      "Accepted registrations waiting for a worker.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(Registrations, ResendVerifications, DownstreamDuration, PublishDuration, PublishFailures, InFlight, AsyncQueued)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Outcome returns the outcome of a request from its response status.
+func Outcome(status int) string {
+	switch {
+	case status < 400:
+		return OutcomeSuccess
+	case status < 500:
+		return OutcomeRejected
+	}
+	return OutcomeFailure
+}
+
+// ErrorClass returns the error class of a failed downstream call.
+func ErrorClass(err error) string {
+	switch err {
+	case nil:
+		return ErrorNone
+	case hystrix.ErrCircuitOpen:
+		return ErrorCircuitOpen
+	case hystrix.ErrTimeout:
+		return ErrorTimeout
+	case hystrix.ErrMaxConcurrency:
+		return ErrorMaxConcurrency
+	}
+	if netErr, ok := err.(net.Error); ok {
+		if netErr.Timeout() {
+			return ErrorTimeout
+		}
+		return ErrorNetwork
+	}
+	return ErrorInternal
+}
+
+// TrackInFlight counts a request of the action as in flight until the returned function is called.
+func TrackInFlight(action string) func() {
+	gauge := InFlight.WithLabelValues(action)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// ObserveDownstream records the latency of a downstream call started at start.
+func ObserveDownstream(command string, start time.Time, resp *http.Response, err error) {
+	status := "error"
+	if err == nil && resp != nil {
+		status = strconv.Itoa(resp.StatusCode/100) + "xx"
+	}
+	DownstreamDuration.WithLabelValues(command, status).Observe(time.Since(start).Seconds())
+}
+
+// ObservePublish records the latency and the failure of an AMQP publish started at start.
+func ObservePublish(kind string, start time.Time, err error) {
+	PublishDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+	if err != nil {
+		PublishFailures.WithLabelValues(kind).Inc()
+	}
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+)
+
+func TestOutcome(t *testing.T) {
+	for status, expected := range map[int]string{
+		http.StatusCreated:             OutcomeSuccess,
+		http.StatusBadRequest:          OutcomeRejected,
+		http.StatusInternalServerError: OutcomeFailure,
+	} {
+		if outcome := Outcome(status); outcome != expected {
+			t.Errorf("%d: expected %s, got %s", status, expected, outcome)
+		}
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	for err, expected := range map[error]string{
+		nil:                       ErrorNone,
+		hystrix.ErrCircuitOpen:    ErrorCircuitOpen,
+		hystrix.ErrTimeout:        ErrorTimeout,
+		hystrix.ErrMaxConcurrency: ErrorMaxConcurrency,
+		errors.New("boom"):        ErrorInternal,
+	} {
+		if class := ErrorClass(err); class != expected {
+			t.Errorf("%v: expected %s, got %s", err, expected, class)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	done := TrackInFlight("register")
+	ObserveDownstream("user-microservice.create_user", time.Now(), &http.Response{StatusCode: 503}, nil)
+	ObservePublish("verification", time.Now(), errors.New("channel closed"))
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	done()
+
+	for _, expected := range []string{
+		`registration_in_flight_requests{action="register"} 1`,
+		`registration_downstream_request_duration_seconds_count{command="user-microservice.create_user",status="5xx"} 1`,
+		`registration_amqp_publish_failures_total{kind="verification"} 1`,
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("expected %s in the metrics", expected)
+		}
+	}
+}
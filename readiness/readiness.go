@@ -0,0 +1,196 @@
+package readiness
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/keitaroinc/goa"
+)
+
+// Statuses of the checks and of the service.
+const (
+	StatusOK     = "OK"
+	StatusFailed = "FAILED"
+)
+
+// Check checks a dependency of the service. It returns an error when the dependency is
+// not available.
+type Check func(ctx context.Context) error
+
+// Result is the result of a check.
+type Result struct {
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+	CheckedAt  time.Time `json:"checkedAt"`
+}
+
+// Report is the readiness of the service: OK when all checks pass.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// check is a registered check with its last result.
+type check struct {
+	name    string
+	timeout time.Duration
+	run     Check
+
+	// mu is held while the check runs, so concurrent probes share one run
+	mu      sync.Mutex
+	result  Result
+	expires time.Time
+}
+
+// Checker runs the registered checks, each with its own timeout, and reuses the result of
+// a check for the cache TTL, so frequent probes do not load the dependencies.
+type Checker struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu     sync.Mutex
+	checks []*check
+}
+
+// NewChecker returns a Checker caching the results for ttl.
+func NewChecker(ttl time.Duration) *Checker {
+	return &Checker{ttl: ttl, now: time.Now}
+}
+
+// Register adds a check that fails when it does not complete within timeout.
+func (c *Checker) Register(name string, timeout time.Duration, run Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, &check{name: name, timeout: timeout, run: run})
+}
+
+// Run runs the checks concurrently, reusing the cached results that did not expire. The
+// checks do not depend on the probe request, as their results are shared by the probes.
+func (c *Checker) Run() Report {
+	c.mu.Lock()
+	checks := append([]*check{}, c.checks...)
+	c.mu.Unlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, chk := range checks {
+		wg.Add(1)
+		go func(i int, chk *check) {
+			defer wg.Done()
+			results[i] = c.result(chk)
+		}(i, chk)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: map[string]Result{}}
+	for i, chk := range checks {
+		report.Checks[chk.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFailed
+		}
+	}
+	return report
+}
+
+// result returns the cached result of the check or runs it.
+func (c *Checker) result(chk *check) Result {
+	chk.mu.Lock()
+	defer chk.mu.Unlock()
+	if c.now().Before(chk.expires) {
+		return chk.result
+	}
+
+	start := c.now()
+	ctx, cancel := context.WithTimeout(context.Background(), chk.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- chk.run(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", chk.timeout)
+	}
+
+	chk.result = Result{Status: StatusOK, DurationMs: c.now().Sub(start).Nanoseconds() / 1e6, CheckedAt: start.UTC()}
+	if err != nil {
+		chk.result.Status, chk.result.Error = StatusFailed, err.Error()
+	}
+	chk.expires = start.Add(c.ttl)
+	return chk.result
+}
+
+// Handler serves the readiness report: 200 OK when all checks pass, 503 Service
+// Unavailable otherwise.
+func Handler(checker *Checker) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		writeReadiness(rw, checker)
+	})
+}
+
+// LivenessHandler reports that the process is up and serving. It does not check the
+// dependencies, so an outage of a dependency does not restart the service.
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		writeLiveness(rw)
+	})
+}
+
+// NewMiddleware serves the readiness and liveness endpoints on the service.
+func NewMiddleware(readinessEndpoint, livenessEndpoint string, checker *Checker) goa.Middleware {
+	return func(h goa.Handler) goa.Handler {
+		return func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+			switch req.URL.Path {
+			case readinessEndpoint:
+				return writeReadiness(rw, checker)
+			case livenessEndpoint:
+				return writeLiveness(rw)
+			}
+			return h(ctx, rw, req)
+		}
+	}
+}
+
+func writeReadiness(rw http.ResponseWriter, checker *Checker) error {
+	report := checker.Run()
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	return json.NewEncoder(rw).Encode(report)
+}
+
+func writeLiveness(rw http.ResponseWriter) error {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	return json.NewEncoder(rw).Encode(map[string]string{"status": StatusOK})
+}
+
+// HTTPCheck checks that the service at the URL returned by url responds without a server
+// error. Any other response, including 401 and 404, means that the service is reachable.
+func HTTPCheck(client *http.Client, url func() string) Check {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequest(http.MethodGet, url(), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("%s responded with %s", url(), resp.Status)
+		}
+		return nil
+	}
+}
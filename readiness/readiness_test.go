@@ -0,0 +1,92 @@
+package readiness
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckerTimeoutAndCache(t *testing.T) {
+	checker := NewChecker(time.Minute)
+	var runs int32
+	checker.Register("fast", time.Second, func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+	checker.Register("slow", 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	report := checker.Run()
+	if report.Status != StatusFailed || report.Checks["fast"].Status != StatusOK {
+		t.Fatalf("expected only the slow check to fail, got %+v", report)
+	}
+	if slow := report.Checks["slow"]; slow.Error != "timed out after 10ms" {
+		t.Fatalf("expected the slow check to time out, got %+v", slow)
+	}
+
+	checker.Run()
+	if runs != 1 {
+		t.Fatalf("expected the cached result to be reused, got %d runs", runs)
+	}
+	checker.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	checker.Run()
+	if runs != 2 {
+		t.Fatalf("expected the check to run again after the cache expired, got %d runs", runs)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	checker := NewChecker(0)
+	failing := true
+	checker.Register("amqp", time.Second, func(ctx context.Context) error {
+		if failing {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+
+	rw := httptest.NewRecorder()
+	Handler(checker).ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/readiness", nil))
+	report := Report{}
+	json.Unmarshal(rw.Body.Bytes(), &report)
+	if rw.Code != http.StatusServiceUnavailable || report.Checks["amqp"].Error != "connection refused" {
+		t.Fatalf("expected 503 with the failed check, got %d %s", rw.Code, rw.Body)
+	}
+
+	failing = false
+	rw = httptest.NewRecorder()
+	Handler(checker).ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/readiness", nil))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected 200 once the check passes, got %d %s", rw.Code, rw.Body)
+	}
+
+	rw = httptest.NewRecorder()
+	LivenessHandler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/liveness", nil))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected the service to be live, got %d", rw.Code)
+	}
+}
+
+func TestHTTPCheck(t *testing.T) {
+	status := http.StatusUnauthorized
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	check := HTTPCheck(&http.Client{Transport: &http.Transport{}}, func() string { return server.URL })
+	if err := check(context.Background()); err != nil {
+		t.Fatalf("expected a reachable service, got %s", err)
+	}
+	status = http.StatusBadGateway
+	if err := check(context.Background()); err == nil {
+		t.Fatal("expected a server error to fail the check")
+	}
+}
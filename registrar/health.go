@@ -0,0 +1,44 @@
+package registrar
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/keitaroinc/goa"
+)
+
+// health is the response of the health endpoint.
+type health struct {
+	Status  string `json:"status"`
+	Gateway Status `json:"gateway"`
+}
+
+// NewCheckMiddleware serves the health endpoint with the registration status. The service
+// is healthy while the registration is pending, so a gateway outage does not restart it.
+func NewCheckMiddleware(healthcheckEndpoint string, registration *Registration) goa.Middleware {
+	return func(h goa.Handler) goa.Handler {
+		return func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+			if req.URL.Path != healthcheckEndpoint {
+				return h(ctx, rw, req)
+			}
+			return writeHealth(rw, registration)
+		}
+	}
+}
+
+// Handler serves the health endpoint with the registration status on the admin listener.
+func Handler(registration *Registration) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		writeHealth(rw, registration)
+	})
+}
+
+func writeHealth(rw http.ResponseWriter, registration *Registration) error {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	return json.NewEncoder(rw).Encode(health{
+		Status:  "OK",
+		Gateway: registration.Status(),
+	})
+}
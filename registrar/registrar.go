@@ -0,0 +1,235 @@
+package registrar
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Microkubes/microservice-registration/config"
+	"github.com/Microkubes/microservice-registration/retry"
+	"github.com/Microkubes/microservice-tools/gateway"
+)
+
+// Registration states.
+const (
+	// StateDisabled means that no registrar is configured.
+	StateDisabled = "disabled"
+	// StatePending means that the service is not registered yet; the registration is retried.
+	StatePending = "pending"
+	// StateRegistered means that the service is registered on the API Gateway.
+	StateRegistered = "registered"
+	// StateUnregistered means that the service was unregistered or the registration was stopped.
+	StateUnregistered = "unregistered"
+)
+
+// Status is the state of the self-registration, as reported on the health endpoint.
+type Status struct {
+	Registrar    string     `json:"registrar"`
+	State        string     `json:"state"`
+	Attempts     int        `json:"attempts"`
+	LastError    string     `json:"lastError,omitempty"`
+	RegisteredAt *time.Time `json:"registeredAt,omitempty"`
+}
+
+// Gateway registers the service on an API Gateway. The calls are made with ctx, so that
+// cancelling it aborts a call in flight.
+type Gateway interface {
+	SelfRegister(ctx context.Context) error
+	Unregister(ctx context.Context) error
+}
+
+// New creates the Gateway of the configured registrar. It returns nil when the
+// self-registration is disabled.
+func New(cfg *config.Config, client *http.Client) (Gateway, error) {
+	switch cfg.Gateway.RegistrarType() {
+	case config.RegistrarKong:
+		return NewKong(cfg.GatewayAdminURL, client, &cfg.Microservice), nil
+	case config.RegistrarStatic:
+		return NewStaticFile(cfg.Gateway.StaticFile, &cfg.Microservice), nil
+	case config.RegistrarNone:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown registrar %q", cfg.Gateway.Registrar)
+}
+
+// Kong registers the service on the Kong admin API.
+type Kong struct {
+	AdminURL     string
+	Client       *http.Client
+	Microservice *gateway.MicroserviceConfig
+}
+
+// NewKong creates a Kong registration.
+func NewKong(adminURL string, client *http.Client, microservice *gateway.MicroserviceConfig) *Kong {
+	return &Kong{
+		AdminURL:     adminURL,
+		Client:       client,
+		Microservice: microservice,
+	}
+}
+
+// SelfRegister creates or updates the API of the service on Kong.
+func (k *Kong) SelfRegister(ctx context.Context) error {
+	return k.gateway(ctx).SelfRegister()
+}
+
+// Unregister disables the target of the service on Kong.
+func (k *Kong) Unregister(ctx context.Context) error {
+	return k.gateway(ctx).Unregister()
+}
+
+// gateway returns a Kong gateway that makes its requests with ctx.
+func (k *Kong) gateway(ctx context.Context) *gateway.KongGateway {
+	client := *k.Client
+	client.Transport = &contextTransport{ctx: ctx, base: k.Client.Transport}
+	return gateway.NewKongGateway(k.AdminURL, &client, k.Microservice)
+}
+
+// contextTransport sends the requests with ctx, as the Kong gateway creates them without
+// a context.
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req.WithContext(t.ctx))
+}
+
+// Registration registers the service in the background, retrying with backoff until it
+// succeeds, and keeps track of the registration status.
+type Registration struct {
+	registration Gateway
+	policy       *retry.Policy
+	timeout      time.Duration
+
+	// attempt serializes the registration attempts and Unregister
+	attempt sync.Mutex
+	stopped bool
+	stop    chan struct{}
+	// ctx is the context of the registration attempts, cancelled by Unregister so that it
+	// does not wait for an attempt in flight
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	status Status
+}
+
+// NewRegistration creates a Registration for the registrar of the given type. A nil
+// registration means that the self-registration is disabled.
+func NewRegistration(registrar string, registration Gateway, cfg *config.GatewayConfig) *Registration {
+	policy := &retry.Policy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+	if cfg != nil && cfg.InitialBackoffMs > 0 {
+		policy.InitialBackoff = time.Duration(cfg.InitialBackoffMs) * time.Millisecond
+	}
+	if cfg != nil && cfg.MaxBackoffMs > 0 {
+		policy.MaxBackoff = time.Duration(cfg.MaxBackoffMs) * time.Millisecond
+	}
+	state := StatePending
+	if registration == nil {
+		state = StateDisabled
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Registration{
+		registration: registration,
+		policy:       policy,
+		timeout:      cfg.AttemptTimeout(),
+		stop:         make(chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+		status: Status{
+			Registrar: registrar,
+			State:     state,
+		},
+	}
+}
+
+// Status returns the current registration status.
+func (r *Registration) Status() Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.status
+}
+
+// Run registers the service, retrying failed attempts with backoff. onError is called with
+// every failed attempt. Run blocks until the service is registered or Unregister is called.
+func (r *Registration) Run(onError func(err error, retryIn time.Duration)) {
+	if r.registration == nil {
+		return
+	}
+	for failures := 1; ; failures++ {
+		done, err := r.register()
+		if done {
+			return
+		}
+		backoff := r.policy.Backoff(failures)
+		onError(err, backoff)
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// register makes one registration attempt. done is true when the service got registered
+// or the registration was stopped.
+func (r *Registration) register() (done bool, err error) {
+	r.attempt.Lock()
+	defer r.attempt.Unlock()
+	if r.stopped {
+		return true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	err = r.registration.SelfRegister(ctx)
+	cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.Attempts++
+	if err != nil {
+		r.status.LastError = err.Error()
+		return false, err
+	}
+	now := time.Now()
+	r.status.State = StateRegistered
+	r.status.LastError = ""
+	r.status.RegisteredAt = &now
+	return true, nil
+}
+
+// Unregister stops the registration retries, cancelling an attempt in flight, and
+// unregisters the service with ctx if it was registered.
+func (r *Registration) Unregister(ctx context.Context) error {
+	r.cancel()
+	r.attempt.Lock()
+	defer r.attempt.Unlock()
+	if r.stopped || r.registration == nil {
+		return nil
+	}
+	r.stopped = true
+	close(r.stop)
+
+	r.mu.Lock()
+	registered := r.status.State == StateRegistered
+	r.status.State = StateUnregistered
+	r.mu.Unlock()
+
+	if !registered {
+		return nil
+	}
+	return r.registration.Unregister(ctx)
+}
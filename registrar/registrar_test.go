@@ -0,0 +1,210 @@
+package registrar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-registration/config"
+	"github.com/Microkubes/microservice-tools/gateway"
+)
+
+// flakyGateway fails the first failures registrations.
+type flakyGateway struct {
+	mu           sync.Mutex
+	failures     int
+	registered   bool
+	unregistered bool
+}
+
+func (f *flakyGateway) SelfRegister(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("connection refused")
+	}
+	f.registered = true
+	return nil
+}
+
+func (f *flakyGateway) Unregister(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.unregistered = true
+	return nil
+}
+
+func TestRegistrationRetries(t *testing.T) {
+	kong := &flakyGateway{failures: 2}
+	registration := NewRegistration(config.RegistrarKong, kong, &config.GatewayConfig{InitialBackoffMs: 1, MaxBackoffMs: 5})
+	if state := registration.Status().State; state != StatePending {
+		t.Fatalf("expected pending, got %s", state)
+	}
+
+	failed := 0
+	registration.Run(func(err error, retryIn time.Duration) {
+		failed++
+		if status := registration.Status(); status.LastError != "connection refused" {
+			t.Fatalf("expected the last error in the status, got %+v", status)
+		}
+	})
+
+	status := registration.Status()
+	if status.State != StateRegistered || status.Attempts != 3 || failed != 2 || status.LastError != "" || status.RegisteredAt == nil {
+		t.Fatalf("unexpected status %+v after %d failures", status, failed)
+	}
+
+	if err := registration.Unregister(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !kong.unregistered || registration.Status().State != StateUnregistered {
+		t.Fatal("expected the service to be unregistered")
+	}
+}
+
+func TestUnregisterStopsRetries(t *testing.T) {
+	kong := &flakyGateway{failures: 1000}
+	registration := NewRegistration(config.RegistrarKong, kong, &config.GatewayConfig{InitialBackoffMs: 1, MaxBackoffMs: 1})
+
+	done := make(chan struct{})
+	go func() {
+		registration.Run(func(error, time.Duration) {})
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := registration.Unregister(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the retries to stop")
+	}
+	if kong.unregistered {
+		t.Fatal("expected no unregistration of a service that never got registered")
+	}
+}
+
+func TestUnregisterCancelsAttempt(t *testing.T) {
+	started := make(chan struct{})
+	kong := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		close(started)
+		<-req.Context().Done()
+	}))
+	defer kong.Close()
+
+	cfg := config.Defaults()
+	cfg.GatewayAdminURL = kong.URL
+	kongGateway, err := New(cfg, &http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registration := NewRegistration(config.RegistrarKong, kongGateway, &config.GatewayConfig{AttemptTimeoutMs: 60000})
+
+	done := make(chan struct{})
+	go func() {
+		registration.Run(func(error, time.Duration) {})
+		close(done)
+	}()
+	<-started
+
+	unregistered := make(chan error)
+	go func() {
+		unregistered <- registration.Unregister(context.Background())
+	}()
+	select {
+	case err := <-unregistered:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Unregister to cancel the attempt in flight")
+	}
+	<-done
+	if state := registration.Status().State; state != StateUnregistered {
+		t.Fatalf("expected unregistered, got %s", state)
+	}
+}
+
+func TestDisabledRegistration(t *testing.T) {
+	registration := NewRegistration(config.RegistrarNone, nil, nil)
+	registration.Run(func(error, time.Duration) {
+		t.Fatal("unexpected registration attempt")
+	})
+	if err := registration.Unregister(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if state := registration.Status().State; state != StateDisabled {
+		t.Fatalf("expected disabled, got %s", state)
+	}
+}
+
+func TestStaticFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registrar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.Defaults()
+	cfg.Gateway = &config.GatewayConfig{Registrar: config.RegistrarStatic, StaticFile: filepath.Join(dir, "registration.json")}
+	registration, err := New(cfg, &http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := registration.SelfRegister(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(cfg.Gateway.StaticFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written gateway.MicroserviceConfig
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+	if written.MicroserviceName != cfg.Microservice.MicroserviceName || written.MicroservicePort != cfg.Microservice.MicroservicePort {
+		t.Fatalf("unexpected registration %s", data)
+	}
+
+	if err := registration.Unregister(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cfg.Gateway.StaticFile); !os.IsNotExist(err) {
+		t.Fatal("expected the registration file to be removed")
+	}
+}
+
+func TestCheckMiddleware(t *testing.T) {
+	registration := NewRegistration(config.RegistrarKong, &flakyGateway{}, nil)
+	registration.Run(func(error, time.Duration) {})
+
+	middleware := NewCheckMiddleware("/healthcheck", registration)
+	handler := middleware(func(ctx context.Context, rw http.ResponseWriter, req *http.Request) error {
+		t.Fatal("expected the health endpoint to be served by the middleware")
+		return nil
+	})
+	rw := httptest.NewRecorder()
+	if err := handler(context.Background(), rw, httptest.NewRequest(http.MethodGet, "/healthcheck", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	var body health
+	if err := json.Unmarshal(rw.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if rw.Code != http.StatusOK || body.Status != "OK" || body.Gateway.State != StateRegistered || body.Gateway.Registrar != config.RegistrarKong {
+		t.Fatalf("unexpected health %d %s", rw.Code, rw.Body.String())
+	}
+}
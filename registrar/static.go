@@ -0,0 +1,63 @@
+package registrar
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Microkubes/microservice-tools/gateway"
+)
+
+// StaticFile is a Gateway that writes the microservice registration (name,
+// port, paths, virtual host, weight and slots) as JSON to a file, for API Gateways that
+// are configured from files.
+type StaticFile struct {
+	File         string
+	Microservice *gateway.MicroserviceConfig
+}
+
+// NewStaticFile creates a StaticFile registration.
+func NewStaticFile(file string, microservice *gateway.MicroserviceConfig) *StaticFile {
+	return &StaticFile{
+		File:         file,
+		Microservice: microservice,
+	}
+}
+
+// SelfRegister writes the registration file. The file is replaced atomically, so a reader
+// never sees a partially written file.
+func (s *StaticFile) SelfRegister(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s.Microservice, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.File), filepath.Base(s.File)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.File)
+}
+
+// Unregister removes the registration file.
+func (s *StaticFile) Unregister(ctx context.Context) error {
+	if err := os.Remove(s.File); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package resilience
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	metricCollector "github.com/afex/hystrix-go/hystrix/metric_collector"
+	"github.com/afex/hystrix-go/hystrix/rolling"
+)
+
+func init() {
+	metricCollector.Registry.Register(newCommandCollector)
+}
+
+// commandCollector keeps the rolling (10 seconds) counters of a hystrix command.
+type commandCollector struct {
+	mutex sync.RWMutex
+
+	requests      *rolling.Number
+	errors        *rolling.Number
+	successes     *rolling.Number
+	failures      *rolling.Number
+	rejects       *rolling.Number
+	shortCircuits *rolling.Number
+	timeouts      *rolling.Number
+}
+
+var collectors = struct {
+	sync.RWMutex
+	byName map[string]*commandCollector
+}{
+	byName: map[string]*commandCollector{},
+}
+
+func newCommandCollector(name string) metricCollector.MetricCollector {
+	c := &commandCollector{}
+	c.Reset()
+
+	collectors.Lock()
+	collectors.byName[name] = c
+	collectors.Unlock()
+
+	return c
+}
+
+// Update records the result of one command execution.
+func (c *commandCollector) Update(r metricCollector.MetricResult) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	c.requests.Increment(r.Attempts)
+	c.errors.Increment(r.Errors)
+	c.successes.Increment(r.Successes)
+	c.failures.Increment(r.Failures)
+	c.rejects.Increment(r.Rejects)
+	c.shortCircuits.Increment(r.ShortCircuits)
+	c.timeouts.Increment(r.Timeouts)
+}
+
+// Reset resets all counters.
+func (c *commandCollector) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.requests = rolling.NewNumber()
+	c.errors = rolling.NewNumber()
+	c.successes = rolling.NewNumber()
+	c.failures = rolling.NewNumber()
+	c.rejects = rolling.NewNumber()
+	c.shortCircuits = rolling.NewNumber()
+	c.timeouts = rolling.NewNumber()
+}
+
+// CircuitSnapshot is the state of a circuit breaker and the rolling counters of its command.
+type CircuitSnapshot struct {
+	Name            string `json:"name"`
+	Open            bool   `json:"open"`
+	ErrorPercentage int    `json:"errorPercentage"`
+	Requests        int64  `json:"requests"`
+	Errors          int64  `json:"errors"`
+	Successes       int64  `json:"successes"`
+	Failures        int64  `json:"failures"`
+	Rejects         int64  `json:"rejects"`
+	ShortCircuits   int64  `json:"shortCircuits"`
+	Timeouts        int64  `json:"timeouts"`
+}
+
+// Snapshot returns the state of the circuits, sorted by name. Only the commands that ran
+// have a circuit: hystrix creates it on the first run, with its collector, and looking up
+// the circuit of any other command would create it.
+func Snapshot() []CircuitSnapshot {
+	collectors.RLock()
+	byName := make(map[string]*commandCollector, len(collectors.byName))
+	for name, c := range collectors.byName {
+		byName[name] = c
+	}
+	collectors.RUnlock()
+
+	now := time.Now()
+	result := []CircuitSnapshot{}
+	for name, c := range byName {
+		snapshot := CircuitSnapshot{Name: name}
+		if circuit, _, err := hystrix.GetCircuit(name); err == nil {
+			snapshot.Open = circuit.IsOpen()
+		}
+
+		c.mutex.RLock()
+		snapshot.Requests = int64(c.requests.Sum(now))
+		snapshot.Errors = int64(c.errors.Sum(now))
+		snapshot.Successes = int64(c.successes.Sum(now))
+		snapshot.Failures = int64(c.failures.Sum(now))
+		snapshot.Rejects = int64(c.rejects.Sum(now))
+		snapshot.ShortCircuits = int64(c.shortCircuits.Sum(now))
+		snapshot.Timeouts = int64(c.timeouts.Sum(now))
+		c.mutex.RUnlock()
+		if snapshot.Requests > 0 {
+			snapshot.ErrorPercentage = int(float64(snapshot.Errors) / float64(snapshot.Requests) * 100)
+		}
+		result = append(result, snapshot)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// SnapshotHandler serves the circuit snapshot as JSON. Only GET is allowed.
+func SnapshotHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			rw.Header().Set("Allow", http.MethodGet)
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		js, err := json.Marshal(Snapshot())
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(js)
+	})
+}
+
+// Mount mounts the resilience endpoints on the admin mux: the effective circuit breaker
+// settings on /resilience, the circuit snapshot on /resilience/circuits and the hystrix
+// dashboard Server-Sent Events stream on /hystrix.stream. The returned stream handler
+// must be stopped on shutdown.
+func Mount(mux *http.ServeMux) *hystrix.StreamHandler {
+	stream := hystrix.NewStreamHandler()
+	stream.Start()
+
+	mux.Handle("/resilience", SettingsHandler())
+	mux.Handle("/resilience/circuits", SnapshotHandler())
+	mux.Handle("/hystrix.stream", stream)
+	return stream
+}
@@ -0,0 +1,136 @@
+package resilience
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/Microkubes/microservice-registration/config"
+	"github.com/afex/hystrix-go/hystrix"
+)
+
+// Hystrix commands used for the calls to the downstream services.
+const (
+	// CreateUserCommand creates the user in the user microservice.
+	CreateUserCommand = "user-microservice.create_user"
+	// UpdateUserProfileCommand creates or updates the user profile.
+	UpdateUserProfileCommand = "user-microservice.update_user_profile"
+	// ResetVerificationCommand resets the verification token of a user.
+	ResetVerificationCommand = "user-microservice.reset_verification"
+	// GetUserProfileCommand fetches the user profile.
+	GetUserProfileCommand = "user-profile.get_user_profile"
+	// GetUserCommand fetches the user, to check whether it is verified.
+	GetUserCommand = "user-microservice.get_user"
+	// DeleteUserCommand deletes the user of a failed registration.
+	DeleteUserCommand = "user-microservice.delete_user"
+	// DeleteUserProfileCommand deletes the user profile of a failed registration.
+	DeleteUserProfileCommand = "user-profile.delete_user_profile"
+)
+
+// DefaultCommands returns the settings applied to the service commands when
+// they are not configured.
+func DefaultCommands() map[string]config.CommandConfig {
+	return map[string]config.CommandConfig{
+		CreateUserCommand: config.CommandConfig{
+			Timeout: 90000,
+		},
+		UpdateUserProfileCommand: config.CommandConfig{
+			Timeout: 90000,
+		},
+		ResetVerificationCommand: config.CommandConfig{},
+		GetUserProfileCommand:    config.CommandConfig{},
+		GetUserCommand:           config.CommandConfig{},
+		DeleteUserCommand:        config.CommandConfig{},
+		DeleteUserProfileCommand: config.CommandConfig{},
+	}
+}
+
+// Configure applies the circuit breaker settings to the hystrix commands. The configured
+// values override the defaults field by field; commands that are not known to the
+// service are configured as well. Configure may be called again to apply new settings, but
+// hystrix sizes the pool of a command when the command first runs, so a changed
+// MaxConcurrentRequests only takes effect for the commands that have not run yet.
+func Configure(cfg *config.ResilienceConfig) {
+	commands := DefaultCommands()
+	if cfg != nil {
+		for name, override := range cfg.Commands {
+			commands[name] = merge(commands[name], override)
+		}
+	}
+	for name, command := range commands {
+		hystrix.ConfigureCommand(name, hystrix.CommandConfig{
+			Timeout:                command.Timeout,
+			MaxConcurrentRequests:  command.MaxConcurrentRequests,
+			RequestVolumeThreshold: command.RequestVolumeThreshold,
+			SleepWindow:            command.SleepWindow,
+			ErrorPercentThreshold:  command.ErrorPercentThreshold,
+		})
+	}
+}
+
+func merge(base, override config.CommandConfig) config.CommandConfig {
+	if override.Timeout != 0 {
+		base.Timeout = override.Timeout
+	}
+	if override.MaxConcurrentRequests != 0 {
+		base.MaxConcurrentRequests = override.MaxConcurrentRequests
+	}
+	if override.ErrorPercentThreshold != 0 {
+		base.ErrorPercentThreshold = override.ErrorPercentThreshold
+	}
+	if override.SleepWindow != 0 {
+		base.SleepWindow = override.SleepWindow
+	}
+	if override.RequestVolumeThreshold != 0 {
+		base.RequestVolumeThreshold = override.RequestVolumeThreshold
+	}
+	return base
+}
+
+// CommandSettings are the effective settings of a hystrix command.
+type CommandSettings struct {
+	Name                   string `json:"name"`
+	Timeout                int64  `json:"timeout"`
+	MaxConcurrentRequests  int    `json:"maxConcurrentRequests"`
+	ErrorPercentThreshold  int    `json:"errorPercentThreshold"`
+	SleepWindow            int64  `json:"sleepWindow"`
+	RequestVolumeThreshold uint64 `json:"requestVolumeThreshold"`
+}
+
+// Settings returns the effective settings of all configured hystrix commands, sorted by name.
+func Settings() []CommandSettings {
+	result := []CommandSettings{}
+	for name, settings := range hystrix.GetCircuitSettings() {
+		result = append(result, CommandSettings{
+			Name:                   name,
+			Timeout:                settings.Timeout.Milliseconds(),
+			MaxConcurrentRequests:  settings.MaxConcurrentRequests,
+			ErrorPercentThreshold:  settings.ErrorPercentThreshold,
+			SleepWindow:            settings.SleepWindow.Milliseconds(),
+			RequestVolumeThreshold: settings.RequestVolumeThreshold,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// SettingsHandler serves the effective command settings as JSON. Only GET is allowed.
+func SettingsHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			rw.Header().Set("Allow", http.MethodGet)
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		js, err := json.Marshal(Settings())
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(js)
+	})
+}
@@ -0,0 +1,139 @@
+package resilience
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-registration/config"
+	"github.com/afex/hystrix-go/hystrix"
+)
+
+func TestConfigure(t *testing.T) {
+	Configure(&config.ResilienceConfig{
+		Commands: map[string]config.CommandConfig{
+			CreateUserCommand: config.CommandConfig{
+				MaxConcurrentRequests: 50,
+			},
+			GetUserProfileCommand: config.CommandConfig{
+				Timeout:     2000,
+				SleepWindow: 1000,
+			},
+		},
+	})
+
+	settings := hystrix.GetCircuitSettings()
+
+	createUser := settings[CreateUserCommand]
+	if createUser.Timeout != 90*time.Second {
+		t.Fatalf("expected the default timeout to be kept, got %s", createUser.Timeout)
+	}
+	if createUser.MaxConcurrentRequests != 50 {
+		t.Fatalf("expected max concurrency 50, got %d", createUser.MaxConcurrentRequests)
+	}
+
+	profile := settings[GetUserProfileCommand]
+	if profile.Timeout != 2*time.Second || profile.SleepWindow != time.Second {
+		t.Fatalf("expected the configured settings, got %+v", profile)
+	}
+	if profile.ErrorPercentThreshold != hystrix.DefaultErrorPercentThreshold {
+		t.Fatalf("expected the hystrix default error threshold, got %d", profile.ErrorPercentThreshold)
+	}
+
+	if _, ok := settings[ResetVerificationCommand]; !ok {
+		t.Fatal("expected the reset verification command to be configured")
+	}
+}
+
+func TestSettingsHandler(t *testing.T) {
+	Configure(nil)
+
+	rw := httptest.NewRecorder()
+	SettingsHandler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/resilience", nil))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rw.Code)
+	}
+	result := []CommandSettings{}
+	if err := json.Unmarshal(rw.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, command := range result {
+		if command.Name == UpdateUserProfileCommand {
+			found = command.Timeout == 90000
+		}
+	}
+	if !found {
+		t.Fatalf("expected the update profile command with 90000ms timeout in %s", rw.Body.String())
+	}
+
+	rw = httptest.NewRecorder()
+	SettingsHandler().ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/resilience", nil))
+	if rw.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", rw.Code)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	name := "test.snapshot_command"
+	hystrix.ConfigureCommand(name, hystrix.CommandConfig{})
+	hystrix.Do(name, func() error { return nil }, nil)
+	hystrix.Do(name, func() error { return errors.New("failed") }, nil)
+
+	// hystrix reports the metrics asynchronously
+	var snapshot CircuitSnapshot
+	for i := 0; i < 100; i++ {
+		for _, circuit := range Snapshot() {
+			if circuit.Name == name {
+				snapshot = circuit
+			}
+		}
+		if snapshot.Requests == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if snapshot.Requests != 2 || snapshot.Successes != 1 || snapshot.Failures != 1 {
+		t.Fatalf("unexpected counters: %+v", snapshot)
+	}
+	if snapshot.ErrorPercentage != 50 {
+		t.Fatalf("expected 50%% errors, got %d", snapshot.ErrorPercentage)
+	}
+	if snapshot.Open {
+		t.Fatal("expected the circuit to be closed")
+	}
+
+	// reading the snapshot does not create the circuits of the commands that did not run
+	unused := "test.unused_command"
+	hystrix.ConfigureCommand(unused, hystrix.CommandConfig{})
+	for _, circuit := range Snapshot() {
+		if circuit.Name == unused {
+			t.Fatalf("expected no circuit for %s", unused)
+		}
+	}
+	collectors.RLock()
+	_, created := collectors.byName[unused]
+	collectors.RUnlock()
+	if created {
+		t.Fatalf("expected the circuit of %s not to be created", unused)
+	}
+}
+
+func TestMount(t *testing.T) {
+	mux := http.NewServeMux()
+	stream := Mount(mux)
+	defer stream.Stop()
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/resilience/circuits", nil))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rw.Code)
+	}
+	if rw.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected JSON, got %s", rw.Header().Get("Content-Type"))
+	}
+}
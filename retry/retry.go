@@ -0,0 +1,256 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Microkubes/microservice-registration/config"
+)
+
+// Call kinds of the downstream calls that go through the Retrier.
+const (
+	// CreateUser is the POST call to the user microservice that creates the user.
+	CreateUser = "create_user"
+	// UpdateUserProfile is the PUT call to the user-profile microservice.
+	UpdateUserProfile = "update_user_profile"
+	// GetUserProfile is the GET call to the user-profile microservice.
+	GetUserProfile = "get_user_profile"
+	// GetUser is the GET call to the user microservice that checks the verification.
+	GetUser = "get_user"
+	// DeleteUser is the DELETE call to the user microservice that removes the user of a
+	// failed registration.
+	DeleteUser = "delete_user"
+	// DeleteUserProfile is the DELETE call to the user-profile microservice that removes the
+	// profile of a failed registration.
+	DeleteUserProfile = "delete_user_profile"
+)
+
+// Policy describes how a failed call is retried.
+type Policy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts.
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after every attempt.
+	Multiplier float64
+	// Jitter is the fraction (0-1) of the backoff that is randomized.
+	Jitter float64
+	// RetryableStatusCodes lists the HTTP status codes that are retried.
+	RetryableStatusCodes []int
+	// RetryNetworkErrors enables retrying of transport level errors.
+	RetryNetworkErrors bool
+}
+
+// DefaultPolicy returns the policy used when nothing is configured.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MaxAttempts:          3,
+		InitialBackoff:       100 * time.Millisecond,
+		MaxBackoff:           2 * time.Second,
+		Multiplier:           2,
+		Jitter:               0.2,
+		RetryableStatusCodes: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		RetryNetworkErrors:   true,
+	}
+}
+
+// Backoff returns the delay before the given retry (1 for the first retry).
+func (p *Policy) Backoff(retry int) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		backoff = backoff * (1 - p.Jitter + 2*p.Jitter*rand.Float64())
+	}
+	return time.Duration(backoff)
+}
+
+// Retryable reports whether the outcome of an attempt should be retried.
+func (p *Policy) Retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return p.RetryNetworkErrors && isNetworkError(err)
+	}
+	if resp == nil {
+		return false
+	}
+	for _, code := range p.RetryableStatusCodes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+func isNetworkError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// Budget limits the number of retries across all calls so that a failing dependency
+// is not hit by a retry storm. Every failed attempt takes a token and every successful
+// one gives back TokenRatio tokens; retries are only allowed while more than half of
+// the tokens are available.
+type Budget struct {
+	mu        sync.Mutex
+	maxTokens float64
+	ratio     float64
+	tokens    float64
+}
+
+// NewBudget creates a Budget with the given token capacity and refill ratio.
+func NewBudget(maxTokens, ratio float64) *Budget {
+	return &Budget{
+		maxTokens: maxTokens,
+		ratio:     ratio,
+		tokens:    maxTokens,
+	}
+}
+
+// Allow reports whether a retry may be attempted.
+func (b *Budget) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens > b.maxTokens/2
+}
+
+func (b *Budget) record(success bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if success {
+		b.tokens = math.Min(b.maxTokens, b.tokens+b.ratio)
+		return
+	}
+	b.tokens = math.Max(0, b.tokens-1)
+}
+
+// Do runs call until it succeeds, returns a non retryable outcome, the policy runs
+// out of attempts, the budget is exhausted or the context is done. The response of
+// the last attempt is returned so the caller can handle the error status as usual.
+func Do(ctx context.Context, policy *Policy, budget *Budget, call func() (*http.Response, error)) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := call()
+		retryable := policy.Retryable(resp, err)
+		budget.record(err == nil && !retryable)
+		if !retryable || attempt >= policy.MaxAttempts || !budget.Allow() {
+			return resp, err
+		}
+		if resp != nil && resp.Body != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(policy.Backoff(attempt)):
+		}
+	}
+}
+
+// Retrier holds the retry policies per call kind and the shared retry budget.
+type Retrier struct {
+	// Default is the policy for call kinds without an override.
+	Default *Policy
+	// Calls holds the policy overrides per call kind.
+	Calls map[string]*Policy
+	// Budget is shared by all calls.
+	Budget *Budget
+	// IdempotentCreate is set when user creation is safe to retry.
+	IdempotentCreate bool
+}
+
+// NewRetrier creates a Retrier from the retry configuration. A nil configuration
+// results in the default policy for every call kind. User creation is never retried
+// unless the configuration marks it as idempotent.
+func NewRetrier(cfg *config.RetryConfig) *Retrier {
+	if cfg == nil {
+		cfg = &config.RetryConfig{}
+	}
+	retrier := &Retrier{
+		Default:          mergePolicy(DefaultPolicy(), &cfg.Default),
+		Calls:            map[string]*Policy{},
+		IdempotentCreate: cfg.IdempotentCreate,
+	}
+	for kind, override := range cfg.Calls {
+		override := override
+		retrier.Calls[kind] = mergePolicy(retrier.Default, &override)
+	}
+	if !cfg.IdempotentCreate {
+		noRetry := *retrier.PolicyFor(CreateUser)
+		noRetry.MaxAttempts = 1
+		retrier.Calls[CreateUser] = &noRetry
+	}
+
+	maxTokens, ratio := cfg.Budget.MaxTokens, cfg.Budget.TokenRatio
+	if maxTokens <= 0 {
+		maxTokens = 10
+	}
+	if ratio <= 0 {
+		ratio = 0.1
+	}
+	retrier.Budget = NewBudget(maxTokens, ratio)
+	return retrier
+}
+
+// PolicyFor returns the policy for the given call kind.
+func (r *Retrier) PolicyFor(kind string) *Policy {
+	if policy, ok := r.Calls[kind]; ok {
+		return policy
+	}
+	return r.Default
+}
+
+// Do runs call with the policy for the given call kind.
+func (r *Retrier) Do(ctx context.Context, kind string, call func() (*http.Response, error)) (*http.Response, error) {
+	return Do(ctx, r.PolicyFor(kind), r.Budget, call)
+}
+
+func mergePolicy(base *Policy, override *config.RetryPolicyConfig) *Policy {
+	policy := *base
+	if override.MaxAttempts > 0 {
+		policy.MaxAttempts = override.MaxAttempts
+	}
+	if override.InitialBackoffMs > 0 {
+		policy.InitialBackoff = time.Duration(override.InitialBackoffMs) * time.Millisecond
+	}
+	if override.MaxBackoffMs > 0 {
+		policy.MaxBackoff = time.Duration(override.MaxBackoffMs) * time.Millisecond
+	}
+	if override.Multiplier > 0 {
+		policy.Multiplier = override.Multiplier
+	}
+	if override.Jitter != nil {
+		policy.Jitter = *override.Jitter
+	}
+	if override.RetryableStatusCodes != nil {
+		policy.RetryableStatusCodes = override.RetryableStatusCodes
+	}
+	if override.RetryNetworkErrors != nil {
+		policy.RetryNetworkErrors = *override.RetryNetworkErrors
+	}
+	return &policy
+}
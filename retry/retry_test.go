@@ -0,0 +1,185 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Microkubes/microservice-registration/config"
+)
+
+func testPolicy() *Policy {
+	policy := DefaultPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = 5 * time.Millisecond
+	return policy
+}
+
+func TestDoRetriesRetryableStatus(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			rw.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := Do(context.Background(), testPolicy(), nil, func() (*http.Response, error) {
+		return http.Get(server.URL)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestDoReturnsLastResponseWhenAttemptsExhausted(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	resp, err := Do(context.Background(), testPolicy(), nil, func() (*http.Response, error) {
+		return http.Get(server.URL)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", resp.StatusCode)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestDoDoesNotRetryClientErrors(t *testing.T) {
+	calls := 0
+	_, err := Do(context.Background(), testPolicy(), nil, func() (*http.Response, error) {
+		calls++
+		return &http.Response{StatusCode: http.StatusBadRequest}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected a single attempt, got %d", calls)
+	}
+}
+
+func TestDoRetriesNetworkErrors(t *testing.T) {
+	calls := 0
+	_, err := Do(context.Background(), testPolicy(), nil, func() (*http.Response, error) {
+		calls++
+		return nil, &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	})
+	if err == nil {
+		t.Fatal("expected network error")
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestDoStopsWhenBudgetIsExhausted(t *testing.T) {
+	budget := NewBudget(2, 0.1)
+	calls := 0
+	Do(context.Background(), testPolicy(), budget, func() (*http.Response, error) {
+		calls++
+		return &http.Response{StatusCode: http.StatusBadGateway}, nil
+	})
+	if calls != 1 {
+		t.Fatalf("expected the budget to stop retries after 1 attempt, got %d", calls)
+	}
+	if budget.Allow() {
+		t.Fatal("expected the budget to deny retries")
+	}
+}
+
+func TestDoStopsOnCanceledContext(t *testing.T) {
+	policy := testPolicy()
+	policy.InitialBackoff = time.Minute
+	policy.MaxBackoff = time.Minute
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := Do(ctx, policy, nil, func() (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusBadGateway}, nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := &Policy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     300 * time.Millisecond,
+		Multiplier:     2,
+	}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}
+	for i, want := range expected {
+		if got := policy.Backoff(i + 1); got != want {
+			t.Fatalf("retry %d: expected %s, got %s", i+1, want, got)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.Backoff(1); got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("jittered backoff out of range: %s", got)
+		}
+	}
+}
+
+func TestNewRetrier(t *testing.T) {
+	noJitter := 0.0
+	retrier := NewRetrier(&config.RetryConfig{
+		Default: config.RetryPolicyConfig{
+			MaxAttempts: 5,
+		},
+		Calls: map[string]config.RetryPolicyConfig{
+			GetUserProfile: config.RetryPolicyConfig{
+				MaxAttempts:          2,
+				RetryableStatusCodes: []int{http.StatusTooManyRequests},
+				Jitter:               &noJitter,
+			},
+		},
+	})
+
+	if retrier.PolicyFor(UpdateUserProfile).MaxAttempts != 5 {
+		t.Fatal("expected the default policy for update_user_profile")
+	}
+	profile := retrier.PolicyFor(GetUserProfile)
+	if profile.MaxAttempts != 2 || len(profile.RetryableStatusCodes) != 1 {
+		t.Fatal("expected the override for get_user_profile")
+	}
+	if profile.InitialBackoff != DefaultPolicy().InitialBackoff {
+		t.Fatal("expected the override to inherit the default backoff")
+	}
+	if profile.Jitter != 0 || retrier.PolicyFor(UpdateUserProfile).Jitter != DefaultPolicy().Jitter {
+		t.Fatal("expected the override to turn the jitter off")
+	}
+	if retrier.PolicyFor(CreateUser).MaxAttempts != 1 {
+		t.Fatal("expected create_user not to be retried unless idempotent")
+	}
+
+	retrier = NewRetrier(&config.RetryConfig{IdempotentCreate: true})
+	if retrier.PolicyFor(CreateUser).MaxAttempts != 3 {
+		t.Fatal("expected create_user to be retried when idempotent")
+	}
+}
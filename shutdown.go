@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/keitaroinc/goa"
+)
+
+// listener is a server that can be shut down gracefully, such as *http.Server and *admin.Server.
+type listener interface {
+	Shutdown(ctx context.Context) error
+}
+
+// Shutdown stops the service gracefully. The steps run in order:
+//  1. Unregister removes the service from the API Gateway, so no new requests are routed to it.
+//     It cancels a registration attempt in flight and gets at most GracePeriod.
+//  2. The Service listener stops accepting new connections and waits for the in-flight
+//     requests for at most GracePeriod.
+//  3. The Listeners (the admin listener) are shut down.
+//  4. The Drain functions wait, for at most GracePeriod, for the background work such as
+//     the async registrations.
+//  5. The Close functions run, closing the AMQP connections still open.
+type Shutdown struct {
+	Service     *goa.Service
+	GracePeriod time.Duration
+	Unregister  func(ctx context.Context) error
+	Listeners   []listener
+	Drain       []func(ctx context.Context) error
+	Close       []func()
+}
+
+// Run runs the shutdown steps. The errors are logged, so that every step runs.
+func (s *Shutdown) Run() {
+	if s.Unregister != nil {
+		unregisterCtx, cancel := context.WithTimeout(context.Background(), s.GracePeriod)
+		if err := s.Unregister(unregisterCtx); err != nil {
+			s.Service.LogError("shutdown: gateway unregister", "err", err)
+		}
+		cancel()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.GracePeriod)
+	defer cancel()
+	if err := s.Service.Server.Shutdown(ctx); err != nil {
+		s.Service.LogError("shutdown: in-flight requests did not finish within the grace period", "err", err)
+		// cancel the requests that are still running
+		s.Service.CancelAll()
+	}
+	for _, l := range s.Listeners {
+		if err := l.Shutdown(ctx); err != nil {
+			s.Service.LogError("shutdown: listener", "err", err)
+		}
+	}
+	if len(s.Drain) > 0 {
+		drainCtx, cancel := context.WithTimeout(context.Background(), s.GracePeriod)
+		for _, drain := range s.Drain {
+			if err := drain(drainCtx); err != nil {
+				s.Service.LogError("shutdown: background work did not finish within the grace period", "err", err)
+			}
+		}
+		cancel()
+	}
+	for _, close := range s.Close {
+		close()
+	}
+	s.Service.LogInfo("shutdown complete")
+}
+
+// RunOnSignal waits for SIGTERM or SIGINT, or for stop to be closed, and runs the shutdown.
+func (s *Shutdown) RunOnSignal(stop <-chan struct{}) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	select {
+	case sig := <-signals:
+		s.Service.LogInfo("shutdown", "signal", sig.String(), "gracePeriod", s.GracePeriod.String())
+	case <-stop:
+	}
+	s.Run()
+}
@@ -0,0 +1,174 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+// RotatedKeyRetention is how long a rotated out system key stays published in the JWKS,
+// so that verifiers with a cached key set can still verify the tokens it signed.
+const RotatedKeyRetention = time.Hour
+
+// JWK is a public JSON Web Key (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// publishedKey is a public key published in the JWKS besides the current system key.
+type publishedKey struct {
+	public crypto.PublicKey
+	method jwtgo.SigningMethod
+	kid    string
+	// until is the end of the publication; zero means forever
+	until time.Time
+}
+
+// LoadPublished loads the previous system keys that are published in the JWKS together
+// with the current key. The files hold either the PEM encoded private or public keys.
+func (s *Signer) LoadPublished(keyFiles []string) error {
+	published := []publishedKey{}
+	for _, keyFile := range keyFiles {
+		key, err := loadPublicKey(keyFile)
+		if err != nil {
+			return err
+		}
+		published = append(published, *key)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.published = published
+	return nil
+}
+
+// PublicKeys returns the JSON Web Keys of the current system key, the configured previous
+// keys and the keys rotated out within the last RotatedKeyRetention.
+func (s *Signer) PublicKeys() ([]JWK, error) {
+	s.mu.Lock()
+	if s.key == nil {
+		s.mu.Unlock()
+		if err := s.Load(); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+	}
+	defer s.mu.Unlock()
+
+	keys := []publishedKey{{
+		public: s.key.private.Public(),
+		method: s.key.method,
+		kid:    s.key.kid,
+	}}
+	now := s.now()
+	retained := s.rotated[:0]
+	for _, key := range s.rotated {
+		if now.Before(key.until) {
+			retained = append(retained, key)
+		}
+	}
+	s.rotated = retained
+	keys = append(keys, s.rotated...)
+	keys = append(keys, s.published...)
+
+	result := []JWK{}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if seen[key.kid] {
+			continue
+		}
+		seen[key.kid] = true
+		jwk, err := toJWK(key)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, jwk)
+	}
+	return result, nil
+}
+
+// rotate keeps the current key published after it is replaced by a new one.
+// It must be called with the lock held.
+func (s *Signer) rotate(next *signingKey) {
+	if s.key == nil || s.key.kid == next.kid {
+		return
+	}
+	s.rotated = append(s.rotated, publishedKey{
+		public: s.key.private.Public(),
+		method: s.key.method,
+		kid:    s.key.kid,
+		until:  s.now().Add(RotatedKeyRetention),
+	})
+}
+
+func toJWK(key publishedKey) (JWK, error) {
+	members, err := jwk(key.public)
+	if err != nil {
+		return JWK{}, err
+	}
+	return JWK{
+		Kty: members["kty"],
+		Kid: key.kid,
+		Use: "sig",
+		Alg: key.method.Alg(),
+		N:   members["n"],
+		E:   members["e"],
+		Crv: members["crv"],
+		X:   members["x"],
+		Y:   members["y"],
+	}, nil
+}
+
+// loadPublicKey reads the public key of a PEM encoded private or public key.
+func loadPublicKey(keyFile string) (*publishedKey, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM encoded key found", keyFile)
+	}
+	if block.Type != "PUBLIC KEY" {
+		private, err := loadKey(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return &publishedKey{
+			public: private.private.Public(),
+			method: private.method,
+			kid:    private.kid,
+		}, nil
+	}
+
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: malformed public key: %s", keyFile, err)
+	}
+	method, err := signingMethod(public)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %s", keyFile, err)
+	}
+	kid, err := thumbprint(public)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %s", keyFile, err)
+	}
+	return &publishedKey{
+		public: public,
+		method: method,
+		kid:    kid,
+	}, nil
+}
@@ -0,0 +1,161 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+// signingKey is a loaded system key together with the JWT signing method inferred
+// from its type and its key ID.
+type signingKey struct {
+	private crypto.Signer
+	method  jwtgo.SigningMethod
+	kid     string
+}
+
+// loadKey reads a PEM encoded private key. RSA keys are accepted in PKCS#1 and PKCS#8,
+// ECDSA keys in SEC 1 and PKCS#8 and Ed25519 keys in PKCS#8 format.
+func loadKey(keyFile string) (*signingKey, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("system key %s: no PEM encoded key found", keyFile)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("system key %s: malformed PKCS#1 key: %s", keyFile, err)
+		}
+	case "EC PRIVATE KEY":
+		if key, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("system key %s: malformed EC key: %s", keyFile, err)
+		}
+	case "PRIVATE KEY":
+		if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("system key %s: malformed PKCS#8 key: %s", keyFile, err)
+		}
+	default:
+		return nil, fmt.Errorf("system key %s: unsupported PEM block type %q", keyFile, block.Type)
+	}
+
+	signing, err := newSigningKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("system key %s: %s", keyFile, err)
+	}
+	return signing, nil
+}
+
+func newSigningKey(key interface{}) (*signingKey, error) {
+	private, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	method, err := signingMethod(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	kid, err := thumbprint(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &signingKey{
+		private: private,
+		method:  method,
+		kid:     kid,
+	}, nil
+}
+
+// signingMethod infers the JWT signing method from the type of the public key.
+func signingMethod(public crypto.PublicKey) (jwtgo.SigningMethod, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return jwtgo.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jwtgo.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwtgo.SigningMethodES384, nil
+		case elliptic.P521():
+			return jwtgo.SigningMethodES512, nil
+		}
+		return nil, fmt.Errorf("unsupported elliptic curve %s", k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", public)
+}
+
+// jwk returns the JSON Web Key members of a public key that take part in the RFC 7638
+// thumbprint, in lexicographic order.
+func jwk(public crypto.PublicKey) (map[string]string, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"e":   encode(big.NewInt(int64(k.E)).Bytes()),
+			"kty": "RSA",
+			"n":   encode(k.N.Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return map[string]string{
+			"crv": k.Curve.Params().Name,
+			"kty": "EC",
+			"x":   encode(pad(k.X.Bytes(), size)),
+			"y":   encode(pad(k.Y.Bytes(), size)),
+		}, nil
+	case ed25519.PublicKey:
+		return map[string]string{
+			"crv": "Ed25519",
+			"kty": "OKP",
+			"x":   encode(k),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", public)
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint of a public key. It is used as the key ID.
+func thumbprint(public crypto.PublicKey) (string, error) {
+	members, err := jwk(public)
+	if err != nil {
+		return "", err
+	}
+	// encoding/json sorts map keys, which gives the canonical member order
+	canonical, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return encode(sum[:]), nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func pad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
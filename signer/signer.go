@@ -0,0 +1,206 @@
+package signer
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// TokenTTL is the lifetime of the self-signed system tokens.
+	TokenTTL = 30 * time.Second
+
+	// RefreshBefore is how long before its expiry a cached token is replaced with a fresh one.
+	RefreshBefore = 5 * time.Second
+)
+
+// Claims are the configurable claims of a system token.
+type Claims struct {
+	// Issuer is the "iss" (and "sub") claim.
+	Issuer string
+	// Audience is the "aud" claim. It is omitted when empty.
+	Audience string
+	// Scope is the "scope" claim.
+	Scope string
+	// Roles are the roles of the system user, sent as a comma separated "roles" claim.
+	Roles []string
+}
+
+// DefaultClaims returns the claims used when nothing is configured for a target service.
+func DefaultClaims() Claims {
+	return Claims{
+		Issuer: "microservice-registration",
+		Scope:  "api:read",
+		Roles:  []string{"system"},
+	}
+}
+
+func (c Claims) cacheKey() string {
+	return strings.Join([]string{c.Issuer, c.Audience, c.Scope, strings.Join(c.Roles, ",")}, "\n")
+}
+
+// cachedToken is a minted token and its expiry time.
+type cachedToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// Signer mints the self-signed system JWTs used for accessing the user and user-profile
+// microservices. The system key is loaded once and reloaded when the key file changes.
+// The signing algorithm is inferred from the key type: RS256 for RSA, ES256/ES384/ES512
+// for ECDSA and EdDSA for Ed25519 keys. A minted token is cached per claim set and reused
+// until shortly before it expires.
+type Signer struct {
+	keyFile string
+
+	mu        sync.Mutex
+	key       *signingKey
+	keyStamp  fileStamp
+	tokens    map[string]cachedToken
+	rotated   []publishedKey
+	published []publishedKey
+
+	now func() time.Time
+}
+
+// fileStamp identifies a version of the key file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// New creates a Signer for the system key in keyFile. The key is loaded on Load or
+// on the first call to Token.
+func New(keyFile string) *Signer {
+	return &Signer{
+		keyFile: keyFile,
+		tokens:  map[string]cachedToken{},
+		now:     time.Now,
+	}
+}
+
+// Load (re)loads the system key from the key file. On error the previously loaded key
+// is kept.
+func (s *Signer) Load() error {
+	stamp, err := stat(s.keyFile)
+	if err != nil {
+		return err
+	}
+	key, err := loadKey(s.keyFile)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotate(key)
+	s.key = key
+	s.keyStamp = stamp
+	s.tokens = map[string]cachedToken{}
+	return nil
+}
+
+// Loaded reports whether a system key is loaded.
+func (s *Signer) Loaded() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.key != nil
+}
+
+// Watch polls the key file every interval and reloads the key when the file changes.
+// Reload errors are passed to onError; the previous key stays in use. Watch blocks
+// until stop is closed.
+func (s *Signer) Watch(interval time.Duration, stop <-chan struct{}, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			stamp, err := stat(s.keyFile)
+			if err != nil {
+				onError(err)
+				continue
+			}
+			s.mu.Lock()
+			changed := stamp != s.keyStamp
+			s.mu.Unlock()
+			if !changed {
+				continue
+			}
+			if err := s.Load(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Token returns a valid system token with the given claims, minting a new one when
+// the cached token is about to expire.
+func (s *Signer) Token(claims Claims) (string, error) {
+	s.mu.Lock()
+	loaded := s.key != nil
+	s.mu.Unlock()
+	if !loaded {
+		if err := s.Load(); err != nil {
+			return "", err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	cacheKey := claims.cacheKey()
+	if cached, ok := s.tokens[cacheKey]; ok && now.Before(cached.expiresAt.Add(-RefreshBefore)) {
+		return cached.token, nil
+	}
+
+	randUUID, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+	expiresAt := now.Add(TokenTTL)
+	mapClaims := jwtgo.MapClaims{
+		"iss":      claims.Issuer,
+		"exp":      expiresAt.Unix(),
+		"jti":      randUUID.String(),
+		"nbf":      0,
+		"sub":      claims.Issuer,
+		"scope":    claims.Scope,
+		"userId":   "system",
+		"username": "system",
+		"roles":    strings.Join(claims.Roles, ","),
+	}
+	if claims.Audience != "" {
+		mapClaims["aud"] = claims.Audience
+	}
+
+	jwt := jwtgo.NewWithClaims(s.key.method, mapClaims)
+	jwt.Header["kid"] = s.key.kid
+	token, err := jwt.SignedString(s.key.private)
+	if err != nil {
+		return "", err
+	}
+	s.tokens[cacheKey] = cachedToken{
+		token:     token,
+		expiresAt: expiresAt,
+	}
+	return token, nil
+}
+
+func stat(keyFile string) (fileStamp, error) {
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}, nil
+}
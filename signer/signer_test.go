@@ -0,0 +1,332 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+func writeKey(t *testing.T, dir, name string, block *pem.Block) string {
+	keyFile := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return keyFile
+}
+
+func generateRSAKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func verify(t *testing.T, token string, key *rsa.PublicKey) jwtgo.MapClaims {
+	claims := jwtgo.MapClaims{}
+	_, err := jwtgo.ParseWithClaims(token, claims, func(*jwtgo.Token) (interface{}, error) {
+		return key, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestTokenPKCS1(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	key := generateRSAKey(t)
+	keyFile := writeKey(t, dir, "system", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	token, err := New(keyFile).Token(DefaultClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := verify(t, token, &key.PublicKey)
+	if claims["iss"] != "microservice-registration" {
+		t.Fatalf("unexpected issuer %v", claims["iss"])
+	}
+}
+
+func TestTokenPKCS8(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	key := generateRSAKey(t)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := writeKey(t, dir, "system", &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	token, err := New(keyFile).Token(DefaultClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify(t, token, &key.PublicKey)
+}
+
+func TestTokenIsCached(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	key := generateRSAKey(t)
+	keyFile := writeKey(t, dir, "system", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	now := time.Now()
+	s := New(keyFile)
+	s.now = func() time.Time { return now }
+
+	first, err := s.Token(DefaultClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(TokenTTL - RefreshBefore - time.Second)
+	second, _ := s.Token(DefaultClaims())
+	if first != second {
+		t.Fatal("expected the cached token")
+	}
+	now = now.Add(2 * time.Second)
+	third, _ := s.Token(DefaultClaims())
+	if third == first {
+		t.Fatal("expected a fresh token shortly before expiry")
+	}
+}
+
+func TestMalformedKeys(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	noPEM := filepath.Join(dir, "no-pem")
+	ioutil.WriteFile(noPEM, []byte("not a key"), 0600)
+	badPKCS1 := writeKey(t, dir, "bad-pkcs1", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte("garbage")})
+	badType := writeKey(t, dir, "bad-type", &pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")})
+
+	cases := map[string]string{
+		noPEM:                        "no PEM encoded key found",
+		badPKCS1:                     "malformed PKCS#1 key",
+		badType:                      "unsupported PEM block type",
+		filepath.Join(dir, "absent"): "no such file",
+	}
+	for keyFile, expected := range cases {
+		_, err := New(keyFile).Token(DefaultClaims())
+		if err == nil {
+			t.Fatalf("%s: expected an error", keyFile)
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("%s: expected %q in %q", keyFile, expected, err.Error())
+		}
+	}
+}
+
+func TestWatchReloadsRotatedKey(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	oldKey := generateRSAKey(t)
+	keyFile := writeKey(t, dir, "system", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(oldKey)})
+
+	s := New(keyFile)
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	// the watcher may see a partially written file, so reload errors are not fatal
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+	go func() {
+		s.Watch(10*time.Millisecond, stop, func(error) {})
+		close(stopped)
+	}()
+
+	newKey := generateRSAKey(t)
+	writeKey(t, dir, "system", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(newKey)})
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(keyFile, future, future)
+
+	for i := 0; i < 100; i++ {
+		token, err := s.Token(DefaultClaims())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := jwtgo.Parse(token, func(*jwtgo.Token) (interface{}, error) {
+			return &newKey.PublicKey, nil
+		}); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("expected tokens to be signed with the rotated key")
+}
+
+func TestTokenKeyTypes(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	sec1, _ := x509.MarshalECPrivateKey(p256)
+	p384PKCS8, _ := x509.MarshalPKCS8PrivateKey(p384)
+	edPKCS8, _ := x509.MarshalPKCS8PrivateKey(edPrivate)
+
+	cases := []struct {
+		name   string
+		block  *pem.Block
+		alg    string
+		public interface{}
+	}{
+		{"es256", &pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}, "ES256", &p256.PublicKey},
+		{"es384", &pem.Block{Type: "PRIVATE KEY", Bytes: p384PKCS8}, "ES384", &p384.PublicKey},
+		{"eddsa", &pem.Block{Type: "PRIVATE KEY", Bytes: edPKCS8}, "EdDSA", edPublic},
+	}
+	for _, c := range cases {
+		keyFile := writeKey(t, dir, c.name, c.block)
+		token, err := New(keyFile).Token(DefaultClaims())
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		parsed, err := jwtgo.Parse(token, func(*jwtgo.Token) (interface{}, error) {
+			return c.public, nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		if parsed.Method.Alg() != c.alg {
+			t.Fatalf("%s: expected alg %s, got %s", c.name, c.alg, parsed.Method.Alg())
+		}
+		kid, _ := thumbprint(c.public)
+		if parsed.Header["kid"] != kid {
+			t.Fatalf("%s: expected kid %s, got %v", c.name, kid, parsed.Header["kid"])
+		}
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// RFC 7638, section 3.1
+	n, _ := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}
+	kid, err := thumbprint(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Fatalf("unexpected thumbprint %s", kid)
+	}
+}
+
+func TestTokenClaims(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	key := generateRSAKey(t)
+	keyFile := writeKey(t, dir, "system", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	s := New(keyFile)
+
+	token, err := s.Token(Claims{
+		Issuer:   "registration",
+		Audience: "user",
+		Scope:    "api:write",
+		Roles:    []string{"system", "admin"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := verify(t, token, &key.PublicKey)
+	expected := map[string]string{
+		"iss":   "registration",
+		"sub":   "registration",
+		"aud":   "user",
+		"scope": "api:write",
+		"roles": "system,admin",
+	}
+	for name, value := range expected {
+		if claims[name] != value {
+			t.Fatalf("expected %s=%s, got %v", name, value, claims[name])
+		}
+	}
+
+	defaultToken, _ := s.Token(DefaultClaims())
+	if defaultToken == token {
+		t.Fatal("expected tokens to be cached per claim set")
+	}
+	if _, ok := verify(t, defaultToken, &key.PublicKey)["aud"]; ok {
+		t.Fatal("expected no audience by default")
+	}
+}
+
+func TestPublicKeys(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	current := generateRSAKey(t)
+	keyFile := writeKey(t, dir, "system", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(current)})
+	previous, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	previousDER, _ := x509.MarshalPKIXPublicKey(&previous.PublicKey)
+	previousFile := writeKey(t, dir, "previous.pub", &pem.Block{Type: "PUBLIC KEY", Bytes: previousDER})
+
+	now := time.Now()
+	s := New(keyFile)
+	s.now = func() time.Time { return now }
+	if err := s.LoadPublished([]string{previousFile}); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := s.PublicKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentKid, _ := thumbprint(&current.PublicKey)
+	previousKid, _ := thumbprint(&previous.PublicKey)
+	if len(keys) != 2 || keys[0].Kid != currentKid || keys[1].Kid != previousKid {
+		t.Fatalf("expected the current and the previous key, got %+v", keys)
+	}
+	if keys[1].Kty != "EC" || keys[1].Alg != "ES256" || keys[1].Crv != "P-256" {
+		t.Fatalf("unexpected previous key %+v", keys[1])
+	}
+
+	// rotate the system key
+	rotated := generateRSAKey(t)
+	writeKey(t, dir, "system", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rotated)})
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	keys, _ = s.PublicKeys()
+	rotatedKid, _ := thumbprint(&rotated.PublicKey)
+	if len(keys) != 3 || keys[0].Kid != rotatedKid || keys[1].Kid != currentKid {
+		t.Fatalf("expected the rotated out key to stay published, got %+v", keys)
+	}
+
+	now = now.Add(RotatedKeyRetention + time.Second)
+	keys, _ = s.PublicKeys()
+	if len(keys) != 2 || keys[1].Kid != previousKid {
+		t.Fatalf("expected the rotated out key to expire, got %+v", keys)
+	}
+}
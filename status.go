@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/Microkubes/microservice-registration/app"
+	"github.com/Microkubes/microservice-registration/lifecycle"
+	"github.com/Microkubes/microservice-registration/resilience"
+	"github.com/Microkubes/microservice-registration/retry"
+	"github.com/Microkubes/microservice-registration/tracing"
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/keitaroinc/goa"
+)
+
+// errNotVerified is the error of a registration that cannot be moved to verified.
+var errNotVerified = goa.NewErrorClass("not_verified", http.StatusConflict)
+
+// RegistrationStatus runs the registrationStatus action. It returns the record of the
+// registration with the given registration ID. The registration IDs are random and only
+// known to the client that registered, so the status is served without authentication.
+func (c *UserController) RegistrationStatus(ctx *app.RegistrationStatusUserContext) error {
+	record, err := c.Tracker.Store.Get(ctx.ID)
+	if err == lifecycle.ErrNotFound {
+		return ctx.NotFound(goa.ErrNotFound(fmt.Sprintf("no registration with ID %s", ctx.ID)))
+	}
+	if err != nil {
+		goa.LogError(ctx, "RegistrationStatus: failed to load the registration", "err", err.Error())
+		return ctx.InternalServerError(goa.ErrInternal(err))
+	}
+	return ctx.OK(registrationStatus(record))
+}
+
+// ConfirmVerification runs the confirmVerification action, called by the verification
+// flow once the user verified the email address. The registration is moved to verified
+// only when the user microservice reports the user as active, so an early or repeated
+// call does not change it.
+func (c *UserController) ConfirmVerification(ctx *app.ConfirmVerificationUserContext) error {
+	record, err := c.Tracker.Store.Get(ctx.ID)
+	if err == lifecycle.ErrNotFound {
+		return ctx.NotFound(goa.ErrNotFound(fmt.Sprintf("no registration with ID %s", ctx.ID)))
+	}
+	if err != nil {
+		goa.LogError(ctx, "ConfirmVerification: failed to load the registration", "err", err.Error())
+		return ctx.InternalServerError(goa.ErrInternal(err))
+	}
+	if record.State == lifecycle.StateVerified {
+		return ctx.OK(registrationStatus(record))
+	}
+	if !lifecycle.CanMove(record.State, lifecycle.StateVerified) || record.UserID == "" {
+		return ctx.Conflict(errNotVerified(fmt.Sprintf("a registration in state %s cannot be verified", record.State)))
+	}
+
+	active, err := c.userActive(ctx, record.UserID)
+	if err != nil {
+		goa.LogError(ctx, "ConfirmVerification: failed to check the verification", "err", err.Error())
+		return ctx.InternalServerError(goa.ErrInternal(err))
+	}
+	if !active {
+		return ctx.Conflict(errNotVerified("the user did not verify the email address yet"))
+	}
+	moved, err := c.Tracker.Move(record.ID, lifecycle.StateVerified, nil, nil)
+	if err != nil {
+		goa.LogError(ctx, "ConfirmVerification: failed to record the verification", "err", err.Error())
+		return ctx.InternalServerError(goa.ErrInternal(err))
+	}
+	return ctx.OK(registrationStatus(moved))
+}
+
+// userActive reports whether the user verified the email address.
+func (c *UserController) userActive(ctx context.Context, userID string) (bool, error) {
+	cfg := c.Store.Get()
+	userURL := fmt.Sprintf("%s/%s", cfg.Services.UserMicroservice.URL, userID)
+	var userResp *http.Response
+	ctx, span := tracing.Start(ctx, "registration_status.get_user")
+	hystErr := hystrix.DoC(ctx, resilience.GetUserCommand, func(ctx context.Context) error {
+		resp, e := c.Retrier.Do(ctx, retry.GetUser, func() (*http.Response, error) {
+			return c.serviceRequest(ctx, resilience.GetUserCommand, cfg.Services.UserMicroservice, http.MethodGet, nil, userURL, nil)
+		})
+		if e != nil {
+			return e
+		}
+		userResp = resp
+		if resp.StatusCode != 200 {
+			return extractErrorMessage(resp)
+		}
+		return nil
+	}, nil)
+	tracing.End(span, hystErr)
+
+	if hystErr != nil {
+		return false, hystErr
+	}
+	body, err := ioutil.ReadAll(userResp.Body)
+	if err != nil {
+		return false, err
+	}
+	user := &app.Users{}
+	if err := json.Unmarshal(body, user); err != nil {
+		return false, err
+	}
+	return user.Active, nil
+}
+
+// startRegistration creates the record of a new registration and returns its ID, or an
+// empty ID when the record could not be created. Tracking failures are logged and do not
+// fail the registration.
+func (c *UserController) startRegistration(ctx context.Context) string {
+	record, err := c.Tracker.Start()
+	if err != nil {
+		goa.LogError(ctx, "registration lifecycle", "state", string(lifecycle.StatePending), "err", err.Error())
+		return ""
+	}
+	return record.ID
+}
+
+// moveRegistration moves the registration with the given ID to state to. Registrations
+// without a record are skipped.
+func (c *UserController) moveRegistration(ctx context.Context, id string, to lifecycle.State, cause error, update func(*lifecycle.Record)) {
+	if id == "" {
+		return
+	}
+	if _, err := c.Tracker.Move(id, to, cause, update); err != nil {
+		goa.LogError(ctx, "registration lifecycle", "id", id, "state", string(to), "err", err.Error())
+	}
+}
+
+// failRegistration moves the registration to failed, when it did not already complete.
+func (c *UserController) failRegistration(ctx context.Context, id, reason string) {
+	if id == "" {
+		return
+	}
+	record, err := c.Tracker.Store.Get(id)
+	if err != nil || !lifecycle.CanMove(record.State, lifecycle.StateFailed) {
+		return
+	}
+	c.moveRegistration(ctx, id, lifecycle.StateFailed, errors.New(reason), nil)
+}
+
+// mailRequeued records that the verification email of the user was queued again.
+func (c *UserController) mailRequeued(ctx context.Context, userID string) {
+	record, err := c.Tracker.Store.FindByUserID(userID)
+	if err != nil || !lifecycle.CanMove(record.State, lifecycle.StateMailQueued) {
+		return
+	}
+	c.moveRegistration(ctx, record.ID, lifecycle.StateMailQueued, nil, nil)
+}
+
+// registrationStatus maps the record to the RegistrationStatus media type.
+func registrationStatus(record *lifecycle.Record) *app.RegistrationStatus {
+	status := &app.RegistrationStatus{
+		ID:        record.ID,
+		State:     string(record.State),
+		Error:     optional(record.Error),
+		UserID:    optional(record.UserID),
+		CreatedAt: record.CreatedAt,
+		UpdatedAt: record.UpdatedAt,
+		History:   []*app.RegistrationTransition{},
+	}
+	for _, transition := range record.History {
+		status.History = append(status.History, &app.RegistrationTransition{
+			State: string(transition.State),
+			At:    transition.At,
+			Error: optional(transition.Error),
+		})
+	}
+	return status
+}
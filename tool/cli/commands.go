@@ -20,6 +20,7 @@ import (
 	uuid "github.com/keitaroinc/goa/uuid"
 	"github.com/spf13/cobra"
 	"log"
+	"net/url"
 	"os"
 	"path"
 	"strconv"
@@ -28,10 +29,31 @@ import (
 )
 
 type (
+	// JwksJwksCommand is the command line data structure for the jwks action of jwks
+	JwksJwksCommand struct {
+		PrettyPrint bool
+	}
+
+	// ConfirmVerificationUserCommand is the command line data structure for the confirmVerification action of user
+	ConfirmVerificationUserCommand struct {
+		// Registration ID
+		ID          string
+		PrettyPrint bool
+	}
+
 	// RegisterUserCommand is the command line data structure for the register action of user
 	RegisterUserCommand struct {
 		Payload     string
 		ContentType string
+		// Process the registration asynchronously, overriding the configured mode
+		Async       string
+		PrettyPrint bool
+	}
+
+	// RegistrationStatusUserCommand is the command line data structure for the registrationStatus action of user
+	RegistrationStatusUserCommand struct {
+		// Registration ID
+		ID          string
 		PrettyPrint bool
 	}
 
@@ -52,11 +74,39 @@ type (
 // RegisterCommands registers the resource action CLI commands.
 func RegisterCommands(app *cobra.Command, c *client.Client) {
 	var command, sub *cobra.Command
+	command = &cobra.Command{
+		Use:   "confirm-verification",
+		Short: `Moves a registration to verified once the user microservice reports the user as active`,
+	}
+	tmp1 := new(ConfirmVerificationUserCommand)
+	sub = &cobra.Command{
+		Use:   `user ["/users/register/ID/verified"]`,
+		Short: ``,
+		RunE:  func(cmd *cobra.Command, args []string) error { return tmp1.Run(c, args) },
+	}
+	tmp1.RegisterFlags(sub, c)
+	sub.PersistentFlags().BoolVar(&tmp1.PrettyPrint, "pp", false, "Pretty print response body")
+	command.AddCommand(sub)
+	app.AddCommand(command)
+	command = &cobra.Command{
+		Use:   "jwks",
+		Short: `Publishes the public keys for verifying the self-signed system tokens`,
+	}
+	tmp2 := new(JwksJwksCommand)
+	sub = &cobra.Command{
+		Use:   `jwks ["/.well-known/jwks.json"]`,
+		Short: `The JSON Web Key Set of the service`,
+		RunE:  func(cmd *cobra.Command, args []string) error { return tmp2.Run(c, args) },
+	}
+	tmp2.RegisterFlags(sub, c)
+	sub.PersistentFlags().BoolVar(&tmp2.PrettyPrint, "pp", false, "Pretty print response body")
+	command.AddCommand(sub)
+	app.AddCommand(command)
 	command = &cobra.Command{
 		Use:   "register",
 		Short: `Creates user`,
 	}
-	tmp1 := new(RegisterUserCommand)
+	tmp3 := new(RegisterUserCommand)
 	sub = &cobra.Command{
 		Use:   `user ["/users/register"]`,
 		Short: ``,
@@ -66,33 +116,47 @@ Payload example:
 
 {
    "active": true,
-   "email": "breana@rennerkoepp.com",
-   "externalId": "At consequatur saepe.",
-   "fullname": "ApPq",
+   "email": "paul_renner@durgancorwin.com",
+   "externalId": "Occaecati facere nemo doloribus accusamus.",
+   "fullname": "J2MMu",
    "namespaces": [
-      "Repudiandae eaque quia cupiditate cumque quibusdam accusantium.",
-      "Repudiandae eaque quia cupiditate cumque quibusdam accusantium.",
-      "Repudiandae eaque quia cupiditate cumque quibusdam accusantium."
+      "Tenetur animi a sunt deserunt tempora quam.",
+      "Tenetur animi a sunt deserunt tempora quam.",
+      "Tenetur animi a sunt deserunt tempora quam."
    ],
-   "password": "0arnperc",
+   "password": "8d34i2en",
    "roles": [
-      "Quo quo amet occaecati ut.",
-      "Quo quo amet occaecati ut."
+      "Aut maiores.",
+      "Aut maiores."
    ],
-   "sendActivationMail": false,
-   "token": "Doloremque aut sed ut impedit voluptatum debitis."
+   "sendActivationMail": true,
+   "token": "Ut dolorum ut et omnis neque."
 }`,
-		RunE: func(cmd *cobra.Command, args []string) error { return tmp1.Run(c, args) },
+		RunE: func(cmd *cobra.Command, args []string) error { return tmp3.Run(c, args) },
 	}
-	tmp1.RegisterFlags(sub, c)
-	sub.PersistentFlags().BoolVar(&tmp1.PrettyPrint, "pp", false, "Pretty print response body")
+	tmp3.RegisterFlags(sub, c)
+	sub.PersistentFlags().BoolVar(&tmp3.PrettyPrint, "pp", false, "Pretty print response body")
+	command.AddCommand(sub)
+	app.AddCommand(command)
+	command = &cobra.Command{
+		Use:   "registration-status",
+		Short: `Returns where a registration is in its lifecycle`,
+	}
+	tmp4 := new(RegistrationStatusUserCommand)
+	sub = &cobra.Command{
+		Use:   `user ["/users/register/ID/status"]`,
+		Short: ``,
+		RunE:  func(cmd *cobra.Command, args []string) error { return tmp4.Run(c, args) },
+	}
+	tmp4.RegisterFlags(sub, c)
+	sub.PersistentFlags().BoolVar(&tmp4.PrettyPrint, "pp", false, "Pretty print response body")
 	command.AddCommand(sub)
 	app.AddCommand(command)
 	command = &cobra.Command{
 		Use:   "resend-verification",
 		Short: `Resends verification email and resets valiation tokens`,
 	}
-	tmp2 := new(ResendVerificationUserCommand)
+	tmp5 := new(ResendVerificationUserCommand)
 	sub = &cobra.Command{
 		Use:   `user ["/users/register/resend-verification"]`,
 		Short: ``,
@@ -101,12 +165,12 @@ Payload example:
 Payload example:
 
 {
-   "email": "Et molestias maxime rem nemo."
+   "email": "Repudiandae quia et eos est."
 }`,
-		RunE: func(cmd *cobra.Command, args []string) error { return tmp2.Run(c, args) },
+		RunE: func(cmd *cobra.Command, args []string) error { return tmp5.Run(c, args) },
 	}
-	tmp2.RegisterFlags(sub, c)
-	sub.PersistentFlags().BoolVar(&tmp2.PrettyPrint, "pp", false, "Pretty print response body")
+	tmp5.RegisterFlags(sub, c)
+	sub.PersistentFlags().BoolVar(&tmp5.PrettyPrint, "pp", false, "Pretty print response body")
 	command.AddCommand(sub)
 	app.AddCommand(command)
 
@@ -322,6 +386,56 @@ found:
 	return nil
 }
 
+// Run makes the HTTP request corresponding to the JwksJwksCommand command.
+func (cmd *JwksJwksCommand) Run(c *client.Client, args []string) error {
+	var path string
+	if len(args) > 0 {
+		path = args[0]
+	} else {
+		path = "/.well-known/jwks.json"
+	}
+	logger := goa.NewLogger(log.New(os.Stderr, "", log.LstdFlags))
+	ctx := goa.WithLogger(context.Background(), logger)
+	resp, err := c.JwksJwks(ctx, path)
+	if err != nil {
+		goa.LogError(ctx, "failed", "err", err)
+		return err
+	}
+
+	goaclient.HandleResponse(c.Client, resp, cmd.PrettyPrint)
+	return nil
+}
+
+// RegisterFlags registers the command flags with the command line.
+func (cmd *JwksJwksCommand) RegisterFlags(cc *cobra.Command, c *client.Client) {
+}
+
+// Run makes the HTTP request corresponding to the ConfirmVerificationUserCommand command.
+func (cmd *ConfirmVerificationUserCommand) Run(c *client.Client, args []string) error {
+	var path string
+	if len(args) > 0 {
+		path = args[0]
+	} else {
+		path = fmt.Sprintf("/users/register/%v/verified", url.QueryEscape(cmd.ID))
+	}
+	logger := goa.NewLogger(log.New(os.Stderr, "", log.LstdFlags))
+	ctx := goa.WithLogger(context.Background(), logger)
+	resp, err := c.ConfirmVerificationUser(ctx, path)
+	if err != nil {
+		goa.LogError(ctx, "failed", "err", err)
+		return err
+	}
+
+	goaclient.HandleResponse(c.Client, resp, cmd.PrettyPrint)
+	return nil
+}
+
+// RegisterFlags registers the command flags with the command line.
+func (cmd *ConfirmVerificationUserCommand) RegisterFlags(cc *cobra.Command, c *client.Client) {
+	var id string
+	cc.Flags().StringVar(&cmd.ID, "id", id, `Registration ID`)
+}
+
 // Run makes the HTTP request corresponding to the RegisterUserCommand command.
 func (cmd *RegisterUserCommand) Run(c *client.Client, args []string) error {
 	var path string
@@ -339,7 +453,16 @@ func (cmd *RegisterUserCommand) Run(c *client.Client, args []string) error {
 	}
 	logger := goa.NewLogger(log.New(os.Stderr, "", log.LstdFlags))
 	ctx := goa.WithLogger(context.Background(), logger)
-	resp, err := c.RegisterUser(ctx, path, &payload, cmd.ContentType)
+	var tmp6 *bool
+	if cmd.Async != "" {
+		var err error
+		tmp6, err = boolVal(cmd.Async)
+		if err != nil {
+			goa.LogError(ctx, "failed to parse flag into *bool value", "flag", "--async", "err", err)
+			return err
+		}
+	}
+	resp, err := c.RegisterUser(ctx, path, &payload, tmp6, cmd.ContentType)
 	if err != nil {
 		goa.LogError(ctx, "failed", "err", err)
 		return err
@@ -353,6 +476,34 @@ func (cmd *RegisterUserCommand) Run(c *client.Client, args []string) error {
 func (cmd *RegisterUserCommand) RegisterFlags(cc *cobra.Command, c *client.Client) {
 	cc.Flags().StringVar(&cmd.Payload, "payload", "", "Request body encoded in JSON")
 	cc.Flags().StringVar(&cmd.ContentType, "content", "", "Request content type override, e.g. 'application/x-www-form-urlencoded'")
+	var async string
+	cc.Flags().StringVar(&cmd.Async, "async", async, `Process the registration asynchronously, overriding the configured mode`)
+}
+
+// Run makes the HTTP request corresponding to the RegistrationStatusUserCommand command.
+func (cmd *RegistrationStatusUserCommand) Run(c *client.Client, args []string) error {
+	var path string
+	if len(args) > 0 {
+		path = args[0]
+	} else {
+		path = fmt.Sprintf("/users/register/%v/status", url.QueryEscape(cmd.ID))
+	}
+	logger := goa.NewLogger(log.New(os.Stderr, "", log.LstdFlags))
+	ctx := goa.WithLogger(context.Background(), logger)
+	resp, err := c.RegistrationStatusUser(ctx, path)
+	if err != nil {
+		goa.LogError(ctx, "failed", "err", err)
+		return err
+	}
+
+	goaclient.HandleResponse(c.Client, resp, cmd.PrettyPrint)
+	return nil
+}
+
+// RegisterFlags registers the command flags with the command line.
+func (cmd *RegistrationStatusUserCommand) RegisterFlags(cc *cobra.Command, c *client.Client) {
+	var id string
+	cc.Flags().StringVar(&cmd.ID, "id", id, `Registration ID`)
 }
 
 // Run makes the HTTP request corresponding to the ResendVerificationUserCommand command.
@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Microkubes/microservice-registration/config"
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func setupFile(t *testing.T) (string, func(context.Context) error) {
+	dir, err := ioutil.TempDir("", "tracing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "spans.json")
+	shutdown, err := Setup(&config.TracingConfig{Exporter: config.TracingFile, File: file}, "registration", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file, shutdown
+}
+
+func TestTransportPropagatesTraceContext(t *testing.T) {
+	file, shutdown := setupFile(t)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		traceparent = req.Header.Get("traceparent")
+	}))
+	defer server.Close()
+
+	ctx, span := Start(context.Background(), "register")
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	client := &http.Client{Transport: Transport(&http.Transport{})}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	End(span, errors.New("profile rejected"))
+
+	if !strings.Contains(traceparent, span.SpanContext().TraceID().String()) {
+		t.Fatalf("expected the trace of the span in traceparent, got %q", traceparent)
+	}
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	spans, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{`"Name":"register"`, `"Name":"HTTP GET"`, "profile rejected"} {
+		if !strings.Contains(string(spans), expected) {
+			t.Errorf("expected %s in the exported spans", expected)
+		}
+	}
+}
+
+func TestAMQPHeaders(t *testing.T) {
+	file, shutdown := setupFile(t)
+	defer os.RemoveAll(filepath.Dir(file))
+	defer shutdown(context.Background())
+
+	ctx, span := Start(context.Background(), "publish")
+	defer span.End()
+	headers := amqp.Table{}
+	InjectAMQP(ctx, headers)
+
+	extracted := trace.SpanContextFromContext(ExtractAMQP(context.Background(), headers))
+	if extracted.TraceID() != span.SpanContext().TraceID() || !extracted.IsRemote() {
+		t.Fatalf("expected the trace of the publisher, got %v", extracted.TraceID())
+	}
+}
+
+func TestSetupUnknownExporter(t *testing.T) {
+	if _, err := Setup(&config.TracingConfig{Exporter: "jaeger"}, "registration", "test"); err == nil {
+		t.Fatal("expected an error for an unknown exporter")
+	}
+}
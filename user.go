@@ -2,37 +2,59 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
-	"encoding/pem"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Microkubes/microservice-registration/app"
+	"github.com/Microkubes/microservice-registration/audit"
 	"github.com/Microkubes/microservice-registration/config"
+	"github.com/Microkubes/microservice-registration/lifecycle"
+	"github.com/Microkubes/microservice-registration/logging"
+	"github.com/Microkubes/microservice-registration/metrics"
+	"github.com/Microkubes/microservice-registration/resilience"
+	"github.com/Microkubes/microservice-registration/retry"
+	"github.com/Microkubes/microservice-registration/signer"
+	"github.com/Microkubes/microservice-registration/tracing"
 	"github.com/Microkubes/microservice-tools/rabbitmq"
 	"github.com/afex/hystrix-go/hystrix"
-	jwtgo "github.com/dgrijalva/jwt-go"
 	"github.com/keitaroinc/goa"
+	"github.com/keitaroinc/goa/middleware"
 	uuid "github.com/satori/go.uuid"
 	"github.com/streadway/amqp"
+	"golang.org/x/sync/errgroup"
 )
 
 // UserController implements the user resource.
 type UserController struct {
 	*goa.Controller
-	Config            *config.Config
+	Store             *config.Store
 	ChannelRabbitMQ   rabbitmq.Channel
 	Client            *http.Client
+	Retrier           *retry.Retrier
+	Signer            *signer.Signer
+	Audit             *audit.Log
+	Tracker           *lifecycle.Tracker
+	Async             *AsyncRegistrar
 	createAmqpChannel AmqpChannelFactory
+
+	// amqpConns holds the open AMQP connections, closed on shutdown
+	amqpMu    sync.Mutex
+	amqpConns map[*amqp.Connection]bool
 }
 
-// AMQPMessage holds data for "email-queue" AMQP channel
+// AMQPMessage holds data for the email AMQP queues
 type AMQPMessage struct {
 	Email        string            `json:"email,omitempty"`
 	Data         map[string]string `json:"data,omitempty"`
@@ -48,40 +70,338 @@ type UserProfile struct {
 type AmqpChannelFactory func(*config.Config) (*amqp.Connection, rabbitmq.Channel, error)
 
 // NewUserController creates a user controller.
-func NewUserController(service *goa.Service, config *config.Config, amqpFactory AmqpChannelFactory, client *http.Client) *UserController {
-	hystrix.ConfigureCommand("user-microservice.create_user", hystrix.CommandConfig{
-		Timeout: 90000,
-	})
-	hystrix.ConfigureCommand("user-microservice.update_user_profile", hystrix.CommandConfig{
-		Timeout: 90000,
-	})
+func NewUserController(service *goa.Service, store *config.Store, amqpFactory AmqpChannelFactory, client *http.Client) *UserController {
+	cfg := store.Get()
 	return &UserController{
 		Controller:        service.NewController("UserController"),
-		Config:            config,
+		Store:             store,
 		Client:            client,
+		Retrier:           retry.NewRetrier(cfg.Retry),
+		Signer:            signer.New(cfg.SystemKey),
+		Tracker:           lifecycle.NewTracker(lifecycle.NewMemoryStore()),
 		createAmqpChannel: amqpFactory,
+		amqpConns:         map[*amqp.Connection]bool{},
 	}
 }
 
 // Register runs the register action. It creates a user and user profile.
 // Also, it sends a massage to the queue in ordet microservice-mail to send
-// varification mail to the user.
+// varification mail to the user. An asynchronous registration is accepted
+// with 202 and processed by the Async workers.
 func (c *UserController) Register(ctx *app.RegisterUserContext) error {
-	user := &app.Users{}
+	defer metrics.TrackInFlight("register")()
+
+	attempt := audit.Event{
+		RequestID: middleware.ContextRequestID(ctx),
+		RemoteIP:  audit.ForwardedIP(ctx.Request),
+		Email:     ctx.Payload.Email,
+		Roles:     ctx.Payload.Roles,
+	}
+	c.recordAudit(ctx, attempt, audit.RegistrationAttempt, "", "")
+
+	result := &registerResult{errorClass: metrics.ErrorInternal, registrationID: c.startRegistration(ctx)}
+	if c.async(ctx) && result.registrationID != "" {
+		job, err := c.newRegistrationJob(ctx.Payload, result.registrationID)
+		if err != nil {
+			goa.LogError(ctx, "Register: Failed to prepare the registration", "err", err.Error())
+			err = ctx.InternalServerError(goa.ErrInternal(err))
+			c.completeRegistration(ctx, attempt, result, ctx.ResponseData.Status)
+			return err
+		}
+		job.ctx, job.audit = detach(ctx), attempt
+		if !c.Async.Enqueue(job) {
+			result.errorClass = metrics.ErrorQueueFull
+			err := ctx.ServiceUnavailable(errQueueFull("too many registrations in progress, retry later"))
+			c.completeRegistration(ctx, attempt, result, ctx.ResponseData.Status)
+			return err
+		}
+		return c.acceptRegistration(ctx, result.registrationID)
+	}
+
+	err := c.register(ctx, result)
+	c.completeRegistration(ctx, attempt, result, ctx.ResponseData.Status)
+	return err
+}
+
+// async reports whether the registration is processed asynchronously: as the request
+// asks, or else as configured.
+func (c *UserController) async(ctx *app.RegisterUserContext) bool {
+	if c.Async == nil {
+		return false
+	}
+	if ctx.Async != nil {
+		return *ctx.Async
+	}
+	return c.Async.Default
+}
+
+// acceptRegistration responds with the pending registration and its status URL.
+func (c *UserController) acceptRegistration(ctx *app.RegisterUserContext, registrationID string) error {
+	record, err := c.Tracker.Store.Get(registrationID)
+	if err != nil {
+		// the job is queued already, so the registration is accepted regardless
+		goa.LogError(ctx, "Register: failed to load the registration", "err", err.Error())
+		now := time.Now().UTC()
+		record = &lifecycle.Record{ID: registrationID, State: lifecycle.StatePending, CreatedAt: now, UpdatedAt: now}
+	}
+	ctx.ResponseData.Header().Set("Location", statusURL(registrationID))
+	return ctx.Accepted(registrationStatus(record))
+}
+
+// completeRegistration counts the registration that completed with the given response
+// status and records its outcome in the registration record and the audit log.
+func (c *UserController) completeRegistration(ctx context.Context, attempt audit.Event, result *registerResult, status int) {
+	outcome := metrics.Outcome(status)
+	if status < 400 {
+		result.errorClass = metrics.ErrorNone
+	} else {
+		c.failRegistration(ctx, result.registrationID, result.errorClass)
+	}
+	metrics.Registrations.WithLabelValues(outcome, result.errorClass).Inc()
+
+	attempt.UserID = result.userID
+	switch outcome {
+	case metrics.OutcomeSuccess:
+		c.recordAudit(ctx, attempt, audit.RegistrationSucceeded, outcome, "")
+	case metrics.OutcomeRejected:
+		c.recordAudit(ctx, attempt, audit.RegistrationRejected, outcome, result.errorClass)
+	default:
+		c.recordAudit(ctx, attempt, audit.RegistrationFailed, outcome, result.errorClass)
+	}
+}
+
+// registerResult is what register reports back for the metrics and the audit log.
+type registerResult struct {
+	// errorClass is the class of the failure
+	errorClass string
+	// userID is the ID of the created user
+	userID string
+	// registrationID is the ID of the registration record, empty when it is not tracked
+	registrationID string
+}
+
+// register registers the user synchronously and fills in the result.
+func (c *UserController) register(ctx *app.RegisterUserContext, result *registerResult) error {
+	job, err := c.newRegistrationJob(ctx.Payload, result.registrationID)
+	if err != nil {
+		goa.LogError(ctx, "Register: Failed to prepare the registration", "err", err.Error())
+		return ctx.InternalServerError(goa.ErrInternal(err))
+	}
+
+	err = c.runRegistration(ctx, job)
+	result.userID = job.userID()
+	if err != nil {
+		c.compensate(detach(ctx), job)
+		regErr, ok := err.(*registrationError)
+		if !ok {
+			return ctx.InternalServerError(goa.ErrInternal(err))
+		}
+		result.errorClass = regErr.class
+		if regErr.rejected {
+			return ctx.BadRequest(regErr.response)
+		}
+		return ctx.InternalServerError(regErr.response)
+	}
+
+	goa.LogInfo(ctx, "New user registered.", "id", job.user.ID)
+	if result.registrationID != "" {
+		ctx.ResponseData.Header().Set("Location", statusURL(result.registrationID))
+	}
+	return ctx.Created(job.user)
+}
+
+// statusURL is the URL of the status of the registration.
+func statusURL(registrationID string) string {
+	return fmt.Sprintf("/users/register/%s/status", registrationID)
+}
+
+// registrationJob is a registration being processed. The completed steps are remembered,
+// so a retried registration continues with the step that failed.
+type registrationJob struct {
+	payload        *app.UserPayload
+	token          string
+	registrationID string
+	// createHeaders are sent with every attempt to create the user
+	createHeaders http.Header
+
+	// ctx carries the logger and the trace of the request, for the async workers
+	ctx context.Context
+	// audit is the registration attempt, completed by the async workers
+	audit audit.Event
+
+	// user is the created user
+	user *app.Users
+	// profileCreated is set once the user profile was created
+	profileCreated bool
+	// mailDone is set once the verification email was queued, or when none is sent
+	mailDone bool
+	// mailQueued is set when the verification email was queued
+	mailQueued bool
+	// recorded is the last state recorded in the registration record
+	recorded lifecycle.State
+}
+
+// userID returns the ID of the created user, or an empty ID.
+func (j *registrationJob) userID() string {
+	if j.user == nil {
+		return ""
+	}
+	return j.user.ID
+}
+
+// registrationError is a failed registration step.
+type registrationError struct {
+	// class is the error class of the metrics
+	class string
+	// rejected is set when the registration was rejected by a downstream service, so
+	// retrying it does not help
+	rejected bool
+	// response is the error returned to the client
+	response error
+}
+
+func (e *registrationError) Error() string {
+	return e.response.Error()
+}
+
+func failed(class string, response error) error {
+	return &registrationError{class: class, response: response}
+}
+
+func rejected(class string, response error) error {
+	return &registrationError{class: class, rejected: true, response: response}
+}
 
+// newRegistrationJob prepares the registration of the user: generates the verification
+// token and the idempotency key of the user creation.
+func (c *UserController) newRegistrationJob(payload *app.UserPayload, registrationID string) (*registrationJob, error) {
 	token := generateToken(42)
-	ctx.Payload.Token = &token
+	payload.Token = &token
+
+	// The idempotency key is shared by all attempts so that the user microservice
+	// can recognize a retried create request.
+	createHeaders := http.Header{}
+	if c.Retrier.IdempotentCreate {
+		idempotencyKey, err := uuid.NewV4()
+		if err != nil {
+			return nil, err
+		}
+		createHeaders.Set("Idempotency-Key", idempotencyKey.String())
+	}
+	return &registrationJob{
+		payload:        payload,
+		token:          token,
+		registrationID: registrationID,
+		createHeaders:  createHeaders,
+	}, nil
+}
+
+// runRegistration runs the registration steps that did not complete yet: it creates the
+// user, then creates the user profile and, concurrently, prepares the verification email,
+// as they only depend on the user. The first failure cancels the other step. The email is
+// published only once the profile was created, so a registration that fails, and whose
+// user is deleted, never sends one.
+func (c *UserController) runRegistration(ctx context.Context, job *registrationJob) error {
+	cfg := c.Store.Get()
+
+	if job.user == nil {
+		user, err := c.createUser(ctx, cfg, job)
+		if err != nil {
+			return err
+		}
+		job.user = user
+		c.moveRegistration(ctx, job.registrationID, lifecycle.StateUserCreated, nil, func(record *lifecycle.Record) {
+			record.UserID = user.ID
+		})
+		job.recorded = lifecycle.StateUserCreated
+	}
+
+	var mail *verificationMail
+	group, groupCtx := errgroup.WithContext(ctx)
+	if !job.profileCreated {
+		group.Go(func() error {
+			if err := c.updateUserProfile(groupCtx, cfg, job.user); err != nil {
+				return err
+			}
+			job.profileCreated = true
+			return nil
+		})
+	}
+	if !job.mailDone {
+		group.Go(func() error {
+			var err error
+			mail, err = c.prepareVerificationMail(groupCtx, cfg, job)
+			return err
+		})
+	}
+	err := group.Wait()
+	if mail != nil {
+		defer c.closeAmqpConnection(mail.conn)
+	}
+	if err == nil && !job.mailDone {
+		err = c.sendVerificationMail(ctx, mail)
+		if err == nil {
+			job.mailDone, job.mailQueued = true, mail != nil
+		}
+	}
+	c.recordSteps(ctx, job)
+	return err
+}
+
+// recordSteps records the completed steps in the order of the state machine, whatever the
+// order they completed in: the queued email only once the profile was created.
+func (c *UserController) recordSteps(ctx context.Context, job *registrationJob) {
+	if job.profileCreated && job.recorded == lifecycle.StateUserCreated {
+		c.moveRegistration(ctx, job.registrationID, lifecycle.StateProfileCreated, nil, nil)
+		job.recorded = lifecycle.StateProfileCreated
+	}
+	if job.mailQueued && job.recorded == lifecycle.StateProfileCreated {
+		c.moveRegistration(ctx, job.registrationID, lifecycle.StateMailQueued, nil, nil)
+		job.recorded = lifecycle.StateMailQueued
+	}
+}
+
+// compensate deletes the user of a registration that failed after the user was created,
+// so the email address can be registered again, and the user profile if it was created.
+// The verification email is published last, so the failed registration did not send one.
+func (c *UserController) compensate(ctx context.Context, job *registrationJob) {
+	if job.user == nil {
+		return
+	}
+	if job.profileCreated {
+		if err := c.deleteUserProfile(ctx, job.user.ID); err != nil {
+			goa.LogError(ctx, "Register: failed to delete the user profile of the failed registration", "id", job.user.ID, "err", err.Error())
+		} else {
+			goa.LogInfo(ctx, "Register: deleted the user profile of the failed registration", "id", job.user.ID)
+		}
+	}
+	if err := c.deleteUser(ctx, job.user.ID); err != nil {
+		goa.LogError(ctx, "Register: failed to delete the user of the failed registration", "id", job.user.ID, "err", err.Error())
+		return
+	}
+	goa.LogInfo(ctx, "Register: deleted the user of the failed registration", "id", job.user.ID)
+}
+
+// createUser creates the user in the user microservice.
+func (c *UserController) createUser(ctx context.Context, cfg *config.Config, job *registrationJob) (*app.Users, error) {
+	user := &app.Users{}
 
 	// Create new user from payload
-	jsonUser, err := json.Marshal(ctx.Payload)
+	jsonUser, err := json.Marshal(job.payload)
 	if err != nil {
-		c.Service.LogError("Register: Failed to deserialize payload", "err", err.Error())
-		return ctx.InternalServerError(goa.ErrInternal(err))
+		goa.LogError(ctx, "Register: Failed to deserialize payload", "err", err.Error())
+		return nil, failed(metrics.ErrorInvalidPayload, goa.ErrInternal(err))
 	}
 
+	callCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	createCtx, createSpan := tracing.Start(callCtx, "register.create_user")
 	output := make(chan *http.Response, 1)
-	errorsChan := hystrix.Go("user-microservice.create_user", func() error {
-		resp, e := makeRequest(c.Client, http.MethodPost, jsonUser, c.Config.Services["user-microservice"], c.Config)
+	errorsChan := hystrix.GoC(createCtx, resilience.CreateUserCommand, func(callCtx context.Context) error {
+		resp, e := c.Retrier.Do(callCtx, retry.CreateUser, func() (*http.Response, error) {
+			return c.serviceRequest(callCtx, resilience.CreateUserCommand, cfg.Services.UserMicroservice, http.MethodPost, jsonUser, cfg.Services.UserMicroservice.URL, job.createHeaders)
+		})
 		if e != nil {
 			return e
 		}
@@ -93,15 +413,17 @@ func (c *UserController) Register(ctx *app.RegisterUserContext) error {
 	select {
 	case out := <-output:
 		createUserResp = out
+		tracing.End(createSpan, nil)
 	case respErr := <-errorsChan:
-		c.Service.LogError("Register: Failed to create user.", "err", respErr.Error())
-		return ctx.InternalServerError(goa.ErrInternal(respErr))
+		tracing.End(createSpan, respErr)
+		goa.LogError(ctx, "Register: Failed to create user.", "err", respErr.Error())
+		return nil, failed(metrics.ErrorClass(respErr), goa.ErrInternal(respErr))
 	}
 
 	body, err := ioutil.ReadAll(createUserResp.Body)
 	if err != nil {
-		c.Service.LogError("Register: Create user returned error response.", "err", err.Error())
-		return ctx.InternalServerError(goa.ErrInternal(err))
+		goa.LogError(ctx, "Register: Create user returned error response.", "err", err.Error())
+		return nil, failed(metrics.ErrorInternal, goa.ErrInternal(err))
 	}
 
 	if createUserResp.StatusCode != 200 && createUserResp.StatusCode != 201 {
@@ -109,37 +431,46 @@ func (c *UserController) Register(ctx *app.RegisterUserContext) error {
 
 		err = json.Unmarshal(body, goaErr)
 		if err != nil {
-			c.Service.LogError("Register: Failed to deserialize create_user respose", "err", err.Error())
-			return ctx.InternalServerError(goa.ErrInternal(err))
+			goa.LogError(ctx, "Register: Failed to deserialize create_user respose", "err", err.Error())
+			return nil, failed(metrics.ErrorUserService, goa.ErrInternal(err))
 		}
 
 		switch createUserResp.StatusCode {
 		case 400:
-			c.Service.LogError("Register: Received bad request (400) error from user microservice.", "err", goaErr.Error())
-			return ctx.BadRequest(goaErr)
+			goa.LogError(ctx, "Register: Received bad request (400) error from user microservice.", "err", goaErr.Error())
+			return nil, rejected(metrics.ErrorUserRejected, goaErr)
 		case 500:
-			c.Service.LogError("Register: Received internal error (500) error from user microservice.", "err", goaErr.Error())
-			return ctx.InternalServerError(goaErr)
+			goa.LogError(ctx, "Register: Received internal error (500) error from user microservice.", "err", goaErr.Error())
+			return nil, failed(metrics.ErrorUserService, goaErr)
 		}
 	}
 
 	if err = json.Unmarshal(body, &user); err != nil {
-		c.Service.LogError("Register: Deserialization error (create user body)", "err", err.Error())
-		return ctx.InternalServerError(goa.ErrInternal(err))
+		goa.LogError(ctx, "Register: Deserialization error (create user body)", "err", err.Error())
+		return nil, failed(metrics.ErrorInternal, goa.ErrInternal(err))
 	}
+	user.Fullname = job.payload.Fullname
+	return user, nil
+}
 
-	// Update user profile. Create it if does not exist
-	user.Fullname = ctx.Payload.Fullname
+// updateUserProfile updates the user profile. It creates it if does not exist.
+func (c *UserController) updateUserProfile(ctx context.Context, cfg *config.Config, user *app.Users) error {
 	userProfile := UserProfile{user.Fullname, user.Email}
 	jsonUseProfile, err := json.Marshal(userProfile)
 	if err != nil {
-		c.Service.LogError("Register: Serialization error (update user profile body)", "err", err.Error())
-		return ctx.InternalServerError(goa.ErrInternal(err))
+		goa.LogError(ctx, "Register: Serialization error (update user profile body)", "err", err.Error())
+		return failed(metrics.ErrorInternal, goa.ErrInternal(err))
 	}
 
+	callCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	profileCtx, profileSpan := tracing.Start(callCtx, "register.update_user_profile")
 	upOutput := make(chan *http.Response, 1)
-	upErrorChan := hystrix.Go("user-microservice.update_user_profile", func() error {
-		resp, errUserProfile := makeRequest(c.Client, http.MethodPut, jsonUseProfile, fmt.Sprintf("%s/%s", c.Config.Services["microservice-user-profile"], user.ID), c.Config)
+	upErrorChan := hystrix.GoC(profileCtx, resilience.UpdateUserProfileCommand, func(callCtx context.Context) error {
+		resp, errUserProfile := c.Retrier.Do(callCtx, retry.UpdateUserProfile, func() (*http.Response, error) {
+			return c.serviceRequest(callCtx, resilience.UpdateUserProfileCommand, cfg.Services.UserProfile, http.MethodPut, jsonUseProfile, fmt.Sprintf("%s/%s", cfg.Services.UserProfile.URL, user.ID), nil)
+		})
 		if errUserProfile != nil {
 			return errUserProfile
 		}
@@ -151,15 +482,17 @@ func (c *UserController) Register(ctx *app.RegisterUserContext) error {
 	select {
 	case out := <-upOutput:
 		createUpResp = out
+		tracing.End(profileSpan, nil)
 	case respErr := <-upErrorChan:
-		c.Service.LogError("Register: Call to update user profile failed.", "err", err.Error())
-		return ctx.InternalServerError(goa.ErrInternal(respErr))
+		tracing.End(profileSpan, respErr)
+		goa.LogError(ctx, "Register: Call to update user profile failed.", "err", respErr.Error())
+		return failed(metrics.ErrorClass(respErr), goa.ErrInternal(respErr))
 	}
 
-	body, err = ioutil.ReadAll(createUpResp.Body)
+	body, err := ioutil.ReadAll(createUpResp.Body)
 	if err != nil {
-		c.Service.LogError("Register: Failed to read update user profile body.", "err", err.Error())
-		return ctx.InternalServerError(goa.ErrInternal(err))
+		goa.LogError(ctx, "Register: Failed to read update user profile body.", "err", err.Error())
+		return failed(metrics.ErrorInternal, goa.ErrInternal(err))
 	}
 
 	if createUpResp.StatusCode != 200 && createUpResp.StatusCode != 204 {
@@ -167,63 +500,104 @@ func (c *UserController) Register(ctx *app.RegisterUserContext) error {
 
 		err = json.Unmarshal(body, goaErr)
 		if err != nil {
-			c.Service.LogError("Register: Deserialization error (update user profile body)", "err", err.Error())
-			return ctx.InternalServerError(goa.ErrInternal(err))
+			goa.LogError(ctx, "Register: Deserialization error (update user profile body)", "err", err.Error())
+			return failed(metrics.ErrorProfileService, goa.ErrInternal(err))
 		}
 
 		switch createUpResp.StatusCode {
 		case 400:
-			c.Service.LogError("Register: Received bad request (400) error from update user profile.", "err", err.Error())
-			return ctx.BadRequest(goaErr)
+			goa.LogError(ctx, "Register: Received bad request (400) error from update user profile.", "err", goaErr.Error())
+			return rejected(metrics.ErrorProfileRejected, goaErr)
 		case 500:
-			c.Service.LogError("Register: Received internal error (500) from update user profile.", "err", err.Error())
-			return ctx.InternalServerError(goaErr)
+			goa.LogError(ctx, "Register: Received internal error (500) from update user profile.", "err", goaErr.Error())
+			return failed(metrics.ErrorProfileService, goaErr)
 		}
 	}
+	return nil
+}
 
-	if ctx.Payload.ExternalID == nil {
-
-		messageData := map[string]string{
-			"name":  user.Fullname,
-			"token": token,
-		}
-		amqpMessage := AMQPMessage{
-			Email:        user.Email,
-			Data:         messageData,
-			TemplateName: "userVerification",
-		}
-
-		body, err := json.Marshal(amqpMessage)
-		fmt.Println("EMAIL INFO -> ", string(body))
-		if err != nil {
-			c.Service.LogError("Register: failed to serialize email payload.", "err", err.Error())
-			return ctx.InternalServerError(goa.ErrInternal(err))
-		}
+// verificationMail is a verification email ready to be published on its channel.
+type verificationMail struct {
+	conn  *amqp.Connection
+	ch    rabbitmq.Channel
+	route config.RouteConfig
+	body  []byte
+}
 
-		if ctx.Payload.SendActivationMail {
-			amqpConn, amqpChan, err := c.createAmqpChannel(c.Config)
+// prepareVerificationMail renders the verification email and opens the channel it is
+// published on. It returns nil when the registration asks for no email.
+func (c *UserController) prepareVerificationMail(ctx context.Context, cfg *config.Config, job *registrationJob) (*verificationMail, error) {
+	if job.payload.ExternalID != nil {
+		return nil, nil
+	}
+	route := cfg.Messaging.Route(config.MessageVerification)
+	messageData := map[string]string{
+		"name":  job.user.Fullname,
+		"token": job.token,
+	}
+	amqpMessage := AMQPMessage{
+		Email:        job.user.Email,
+		Data:         messageData,
+		TemplateName: route.Template,
+	}
 
-			if err != nil {
-				log.Println("Failed to open connection to queue: ", err.Error())
-				return ctx.InternalServerError(goa.ErrInternal(err))
-			}
+	body, err := json.Marshal(amqpMessage)
+	if err != nil {
+		goa.LogError(ctx, "Register: failed to serialize email payload.", "err", err.Error())
+		return nil, failed(metrics.ErrorInternal, goa.ErrInternal(err))
+	}
+	logging.Debug(ctx, "Register: verification email", "message", string(body))
 
-			defer amqpConn.Close()
+	if !job.payload.SendActivationMail {
+		return nil, nil
+	}
+	amqpConn, amqpChan, err := c.openAmqpChannel(cfg)
+	if err != nil {
+		goa.LogError(ctx, "Register: Failed to open connection to queue.", "err", err.Error())
+		return nil, failed(metrics.ErrorMessaging, goa.ErrInternal(err))
+	}
+	return &verificationMail{conn: amqpConn, ch: amqpChan, route: route, body: body}, nil
+}
 
-			if err := amqpChan.Send("email-queue", body); err != nil {
-				c.Service.LogError("Register: failed to serialize email payload.", "err", err.Error())
-				return ctx.InternalServerError(goa.ErrInternal(err))
-			}
-		}
+// sendVerificationMail publishes the prepared verification email. A nil mail is not sent.
+func (c *UserController) sendVerificationMail(ctx context.Context, mail *verificationMail) error {
+	if mail == nil {
+		return nil
 	}
-	c.Service.LogInfo("New user registered.", "id", user.ID)
-	return ctx.Created(user)
+	if err := publish(ctx, mail.ch, config.MessageVerification, mail.route, mail.body); err != nil {
+		goa.LogError(ctx, "Register: failed to publish the verification email.", "err", err.Error())
+		return failed(metrics.ErrorMessaging, goa.ErrInternal(err))
+	}
+	return nil
 }
 
 // ResendVerification resets the activation token and resends activation emal to user.
 func (c *UserController) ResendVerification(ctx *app.ResendVerificationUserContext) error {
+	defer metrics.TrackInFlight("resend_verification")()
+
+	err := c.resendVerification(ctx)
+	outcome := metrics.Outcome(ctx.ResponseData.Status)
+	metrics.ResendVerifications.WithLabelValues(outcome).Inc()
+	c.recordAudit(ctx, audit.Event{
+		RequestID: middleware.ContextRequestID(ctx),
+		RemoteIP:  audit.ForwardedIP(ctx.Request),
+		Email:     ctx.Payload.Email,
+	}, audit.VerificationResent, outcome, "")
+	return err
+}
+
+// recordAudit records the event with the given type, outcome and reason in the audit log.
+// A failure to record is logged and does not fail the request.
+func (c *UserController) recordAudit(ctx context.Context, event audit.Event, eventType, outcome, reason string) {
+	event.Type, event.Outcome, event.Reason = eventType, outcome, reason
+	if err := c.Audit.Record(event); err != nil {
+		goa.LogError(ctx, "audit log", "type", eventType, "err", err.Error())
+	}
+}
+
+func (c *UserController) resendVerification(ctx *app.ResendVerificationUserContext) error {
 	// 1. Reset user token
-	userID, token, err := c.resetVerificationToken(ctx.Payload.Email)
+	userID, token, err := c.resetVerificationToken(ctx, ctx.Payload.Email)
 	if err != nil {
 		if restErr, ok := err.(*RestClientError); ok {
 			switch restErr.Code {
@@ -238,7 +612,7 @@ func (c *UserController) ResendVerification(ctx *app.ResendVerificationUserConte
 		return ctx.InternalServerError(err)
 	}
 	// 2. Fetch user profile
-	profile, err := c.fetchUserProfile(userID)
+	profile, err := c.fetchUserProfile(ctx, userID)
 	if err != nil {
 		if restErr, ok := err.(*RestClientError); ok {
 			switch restErr.Code {
@@ -255,24 +629,27 @@ func (c *UserController) ResendVerification(ctx *app.ResendVerificationUserConte
 		return ctx.InternalServerError(err)
 	}
 	// 3. Schedule send mail
-	if err = c.scheduleSendVerificationMail(userID, profile, token); err != nil {
+	if err = c.scheduleSendVerificationMail(ctx, profile, token); err != nil {
 		return ctx.InternalServerError(err)
 	}
+	c.mailRequeued(ctx, userID)
 
 	return ctx.OK([]byte{})
 }
 
-func (c *UserController) resetVerificationToken(email string) (userID, token string, err error) {
+func (c *UserController) resetVerificationToken(ctx context.Context, email string) (userID, token string, err error) {
 	resetTokenPayload, err := json.Marshal(map[string]string{
 		"email": email,
 	})
 	if err != nil {
 		return "", "", err
 	}
-	resetTokenURL := fmt.Sprintf("%s/verification/reset", c.Config.Services["user-microservice"])
+	cfg := c.Store.Get()
+	resetTokenURL := fmt.Sprintf("%s/verification/reset", cfg.Services.UserMicroservice.URL)
 	var resetResponse *http.Response
-	hystErr := hystrix.Do("user-microservice.reset_verification", func() error {
-		resp, e := makeRequest(c.Client, "POST", resetTokenPayload, resetTokenURL, c.Config)
+	ctx, span := tracing.Start(ctx, "resend_verification.reset_verification")
+	hystErr := hystrix.Do(resilience.ResetVerificationCommand, func() error {
+		resp, e := c.serviceRequest(ctx, resilience.ResetVerificationCommand, cfg.Services.UserMicroservice, "POST", resetTokenPayload, resetTokenURL, nil)
 		if e != nil {
 			return e
 		}
@@ -282,6 +659,7 @@ func (c *UserController) resetVerificationToken(email string) (userID, token str
 		}
 		return nil
 	}, nil)
+	tracing.End(span, hystErr)
 
 	if hystErr != nil {
 		return "", "", hystErr
@@ -298,11 +676,15 @@ func (c *UserController) resetVerificationToken(email string) (userID, token str
 	return tokenResponse["id"], tokenResponse["token"], nil
 }
 
-func (c *UserController) fetchUserProfile(userID string) (profile *UserProfile, err error) {
-	fetchUserProfileURL := fmt.Sprintf("%s/%s", c.Config.Services["microservice-user-profile"], userID)
+func (c *UserController) fetchUserProfile(ctx context.Context, userID string) (profile *UserProfile, err error) {
+	cfg := c.Store.Get()
+	fetchUserProfileURL := fmt.Sprintf("%s/%s", cfg.Services.UserProfile.URL, userID)
 	var fetchProfileResp *http.Response
-	hystErr := hystrix.Do("user-profile.get_user_profile", func() error {
-		resp, e := makeRequest(c.Client, "GET", nil, fetchUserProfileURL, c.Config)
+	ctx, span := tracing.Start(ctx, "resend_verification.get_user_profile")
+	hystErr := hystrix.DoC(ctx, resilience.GetUserProfileCommand, func(ctx context.Context) error {
+		resp, e := c.Retrier.Do(ctx, retry.GetUserProfile, func() (*http.Response, error) {
+			return c.serviceRequest(ctx, resilience.GetUserProfileCommand, cfg.Services.UserProfile, "GET", nil, fetchUserProfileURL, nil)
+		})
 		if e != nil {
 			return e
 		}
@@ -312,6 +694,7 @@ func (c *UserController) fetchUserProfile(userID string) (profile *UserProfile,
 		}
 		return nil
 	}, nil)
+	tracing.End(span, hystErr)
 
 	if hystErr != nil {
 		return nil, hystErr
@@ -327,7 +710,57 @@ func (c *UserController) fetchUserProfile(userID string) (profile *UserProfile,
 	return profile, nil
 }
 
-func (c *UserController) scheduleSendVerificationMail(userID string, profile *UserProfile, token string) error {
+// deleteUser deletes the user from the user microservice. A user that does not exist is
+// deleted already.
+func (c *UserController) deleteUser(ctx context.Context, userID string) error {
+	cfg := c.Store.Get()
+	deleteUserURL := fmt.Sprintf("%s/%s", cfg.Services.UserMicroservice.URL, userID)
+	ctx, span := tracing.Start(ctx, "register.delete_user")
+	hystErr := hystrix.DoC(ctx, resilience.DeleteUserCommand, func(ctx context.Context) error {
+		resp, e := c.Retrier.Do(ctx, retry.DeleteUser, func() (*http.Response, error) {
+			return c.serviceRequest(ctx, resilience.DeleteUserCommand, cfg.Services.UserMicroservice, http.MethodDelete, nil, deleteUserURL, nil)
+		})
+		if e != nil {
+			return e
+		}
+		switch resp.StatusCode {
+		case 200, 204, 404:
+			resp.Body.Close()
+			return nil
+		}
+		return extractErrorMessage(resp)
+	}, nil)
+	tracing.End(span, hystErr)
+	return hystErr
+}
+
+// deleteUserProfile deletes the user profile of a failed registration. A profile that is
+// already gone is not an error.
+func (c *UserController) deleteUserProfile(ctx context.Context, userID string) error {
+	cfg := c.Store.Get()
+	deleteProfileURL := fmt.Sprintf("%s/%s", cfg.Services.UserProfile.URL, userID)
+	ctx, span := tracing.Start(ctx, "register.delete_user_profile")
+	hystErr := hystrix.DoC(ctx, resilience.DeleteUserProfileCommand, func(ctx context.Context) error {
+		resp, e := c.Retrier.Do(ctx, retry.DeleteUserProfile, func() (*http.Response, error) {
+			return c.serviceRequest(ctx, resilience.DeleteUserProfileCommand, cfg.Services.UserProfile, http.MethodDelete, nil, deleteProfileURL, nil)
+		})
+		if e != nil {
+			return e
+		}
+		switch resp.StatusCode {
+		case 200, 204, 404:
+			resp.Body.Close()
+			return nil
+		}
+		return extractErrorMessage(resp)
+	}, nil)
+	tracing.End(span, hystErr)
+	return hystErr
+}
+
+func (c *UserController) scheduleSendVerificationMail(ctx context.Context, profile *UserProfile, token string) error {
+	cfg := c.Store.Get()
+	route := cfg.Messaging.Route(config.MessageResend)
 
 	messageData := map[string]string{
 		"name":  profile.Fullname,
@@ -336,7 +769,7 @@ func (c *UserController) scheduleSendVerificationMail(userID string, profile *Us
 	amqpMessage := AMQPMessage{
 		Email:        profile.Email,
 		Data:         messageData,
-		TemplateName: "userVerification",
+		TemplateName: route.Template,
 	}
 
 	body, err := json.Marshal(amqpMessage)
@@ -344,15 +777,13 @@ func (c *UserController) scheduleSendVerificationMail(userID string, profile *Us
 		return err
 	}
 
-	amqpConn, amqpChan, err := c.createAmqpChannel(c.Config)
+	amqpConn, amqpChan, err := c.openAmqpChannel(cfg)
 	if err != nil {
 		return err
 	}
-	if amqpConn != nil {
-		defer amqpConn.Close()
-	}
+	defer c.closeAmqpConnection(amqpConn)
 
-	if err = amqpChan.Send("verification-email", body); err != nil {
+	if err = publish(ctx, amqpChan, config.MessageResend, route, body); err != nil {
 		return err
 	}
 
@@ -394,63 +825,76 @@ func extractErrorMessage(resp *http.Response) error {
 	}
 }
 
-// makeRequest makes http request
-func makeRequest(client *http.Client, method string, payload []byte, url string, cfg *config.Config) (*http.Response, error) {
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(payload))
-	if err != nil {
-		return nil, err
+// serviceRequest makes http request to a downstream service, with the timeout and
+// authentication configured for that service. The latency is recorded for the hystrix
+// command the request is made for.
+func (c *UserController) serviceRequest(ctx context.Context, command string, service config.ServiceConfig, method string, payload []byte, url string, headers http.Header) (resp *http.Response, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.ObserveDownstream(command, start, resp, err)
+	}()
+
+	client := c.Client
+	if service.TimeoutMs > 0 {
+		withTimeout := *c.Client
+		withTimeout.Timeout = time.Duration(service.TimeoutMs) * time.Millisecond
+		client = &withTimeout
 	}
 
-	token, err := selfSignJWT(cfg)
+	req, err := newRequest(method, payload, url, headers)
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	switch service.AuthType() {
+	case config.AuthNone:
+	case config.AuthBasic:
+		req.SetBasicAuth(service.Auth.Username, service.Auth.Password)
+	default:
+		token, err := c.Signer.Token(tokenClaims(service.Token))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 	}
-	return resp, err
+	return client.Do(req)
 }
 
-// selfSignJWT generates a JWT token which is self-signed with the system private key.
-// This token is used for accesing the user and user-profile microservices.
-func selfSignJWT(cfg *config.Config) (string, error) {
-	key, err := ioutil.ReadFile(cfg.SystemKey)
-	if err != nil {
-		return "", err
+// tokenClaims returns the system token claims for the token configuration of a service.
+func tokenClaims(cfg *config.TokenConfig) signer.Claims {
+	claims := signer.DefaultClaims()
+	if cfg == nil {
+		return claims
 	}
-
-	block, _ := pem.Decode(key)
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
-	if err != nil {
-		return "", err
+	if cfg.Issuer != "" {
+		claims.Issuer = cfg.Issuer
+	}
+	if cfg.Scope != "" {
+		claims.Scope = cfg.Scope
 	}
+	if len(cfg.Roles) > 0 {
+		claims.Roles = cfg.Roles
+	}
+	claims.Audience = cfg.Audience
+	return claims
+}
 
-	randUUID, err := uuid.NewV4()
+// newRequest creates a JSON request with additional request headers.
+func newRequest(method string, payload []byte, url string, headers http.Header) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(payload))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	claims := jwtgo.MapClaims{
-		"iss":      "microservice-registration",
-		"exp":      time.Now().Add(time.Duration(30) * time.Second).Unix(),
-		"jti":      randUUID.String(),
-		"nbf":      0,
-		"sub":      "microservice-registration",
-		"scope":    "api:read",
-		"userId":   "system",
-		"username": "system",
-		"roles":    "system",
+	for name, values := range headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
 	}
 
-	tokenRS := jwtgo.NewWithClaims(jwtgo.SigningMethodRS256, claims)
-	tokenStr, err := tokenRS.SignedString(privateKey)
-
-	return tokenStr, err
+	req.Header.Add("Content-Type", "application/json")
+	return req, nil
 }
 
 func generateToken(n int) string {
@@ -472,17 +916,72 @@ func (e *RestClientError) Error() string {
 	return fmt.Sprintf("%d %s %s", e.Code, e.StatusLine, e.Message)
 }
 
+// CreateRabbitmqChannel connects to the configured RabbitMQ server and opens a channel.
 func CreateRabbitmqChannel(cfg *config.Config) (*amqp.Connection, rabbitmq.Channel, error) {
-	connRabbitMQ, channelRabbitMQ, err := rabbitmq.Dial(
-		cfg.RabbitMQ["username"],
-		cfg.RabbitMQ["password"],
-		cfg.RabbitMQ["host"],
-		cfg.RabbitMQ["post"],
-	)
+	rabbitCfg := cfg.RabbitMQ
+	amqpURL := &url.URL{
+		Scheme: "amqp",
+		User:   url.UserPassword(rabbitCfg.Username, rabbitCfg.Password),
+		Host:   net.JoinHostPort(rabbitCfg.Host, strconv.Itoa(rabbitCfg.Port)),
+		Path:   "/",
+	}
+	amqpConfig := amqp.Config{
+		Vhost:     rabbitCfg.VHost,
+		Heartbeat: time.Duration(rabbitCfg.HeartbeatMs) * time.Millisecond,
+		Locale:    "en_US",
+	}
+	if rabbitCfg.TLS != nil {
+		tlsConfig, err := amqpTLSConfig(rabbitCfg.TLS)
+		if err != nil {
+			return nil, nil, err
+		}
+		amqpURL.Scheme = "amqps"
+		amqpConfig.TLSClientConfig = tlsConfig
+	}
+	if amqpConfig.Heartbeat == 0 {
+		amqpConfig.Heartbeat = 10 * time.Second
+	}
+
+	connRabbitMQ, err := amqp.DialConfig(amqpURL.String(), amqpConfig)
 	if err != nil {
 		return nil, nil, err
 	}
+	channelRabbitMQ, err := connRabbitMQ.Channel()
+	if err != nil {
+		connRabbitMQ.Close()
+		return nil, nil, err
+	}
 	return connRabbitMQ, &rabbitmq.AMQPChannel{
 		Channel: channelRabbitMQ,
 	}, nil
 }
+
+// amqpTLSConfig builds the TLS configuration of the RabbitMQ connection.
+func amqpTLSConfig(cfg *config.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: cfg.ServerName,
+	}
+	if cfg.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		caPEM, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("rabbitmq: CA bundle: %s", err)
+		}
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("rabbitmq: no certificates found in CA bundle %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("rabbitmq: client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
@@ -9,18 +10,31 @@ import (
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Microkubes/microservice-tools/rabbitmq"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/trace"
 
 	"gopkg.in/h2non/gock.v1"
 
 	"github.com/Microkubes/microservice-registration/app"
 	"github.com/Microkubes/microservice-registration/app/test"
+	"github.com/Microkubes/microservice-registration/audit"
 	"github.com/Microkubes/microservice-registration/config"
+	"github.com/Microkubes/microservice-registration/lifecycle"
+	"github.com/Microkubes/microservice-registration/logging"
+	"github.com/Microkubes/microservice-registration/metrics"
+	"github.com/Microkubes/microservice-registration/readiness"
+	"github.com/Microkubes/microservice-registration/signer"
+	"github.com/Microkubes/microservice-registration/tracing"
 	"github.com/keitaroinc/goa"
 )
 
@@ -54,7 +68,7 @@ var _ = json.Unmarshal(configBytes, cfg)
 
 var (
 	service = goa.New("user-test")
-	ctrl    = NewUserController(service, cfg, CreateMockAmqpChannel, &http.Client{})
+	ctrl    = NewUserController(service, config.NewStore(cfg), CreateMockAmqpChannel, &http.Client{})
 )
 
 func CreateMockAmqpChannel(cfg *config.Config) (*amqp.Connection, rabbitmq.Channel, error) {
@@ -87,7 +101,7 @@ func TestRegisterUserCreated(t *testing.T) {
 		Roles:      []string{"admin", "user"},
 	}
 
-	gock.New(cfg.Services["user-microservice"]).
+	gock.New(cfg.Services.UserMicroservice.URL).
 		Post("").
 		Reply(201).
 		JSON(map[string]interface{}{
@@ -99,7 +113,7 @@ func TestRegisterUserCreated(t *testing.T) {
 			"active":     false,
 		})
 
-	gock.New(cfg.Services["microservice-user-profile"]).
+	gock.New(cfg.Services.UserProfile.URL).
 		Put(fmt.Sprintf("/%s", "59804b3c0000000000000000")).
 		Reply(204).
 		JSON(map[string]interface{}{
@@ -108,11 +122,81 @@ func TestRegisterUserCreated(t *testing.T) {
 		})
 
 	gock.InterceptClient(ctrl.Client)
-	_, u := test.RegisterUserCreated(t, context.Background(), service, ctrl, user)
+	registered := metrics.Registrations.WithLabelValues(metrics.OutcomeSuccess, metrics.ErrorNone)
+	before := testutil.ToFloat64(registered)
+	auditSink := &auditRecorder{}
+	ctrl.Audit = audit.New(auditSink)
+	defer func() { ctrl.Audit = nil }()
+	_, u := test.RegisterUserCreated(t, context.Background(), service, ctrl, nil, user)
 
 	if u == nil {
 		t.Fatal("Nil user")
 	}
+	if testutil.ToFloat64(registered)-before != 1 {
+		t.Fatal("expected the registration to be counted")
+	}
+	if n, err := audit.Verify(strings.NewReader(auditSink.String())); err != nil || n != 2 {
+		t.Fatalf("expected the attempt and the outcome in the audit log, got %d, %v", n, err)
+	}
+	for _, expected := range []string{`"type":"registration.attempt"`, `"type":"registration.succeeded"`, `"userId":"59804b3c0000000000000000"`, `"roles":["admin","user"]`} {
+		if !strings.Contains(auditSink.String(), expected) {
+			t.Errorf("expected %s in the audit log", expected)
+		}
+	}
+}
+
+// auditRecorder is an audit.Sink that keeps the entries in memory.
+type auditRecorder struct {
+	bytes.Buffer
+}
+
+func (r *auditRecorder) Write(entry []byte) error {
+	r.Buffer.Write(append(entry, '\n'))
+	return nil
+}
+
+func (r *auditRecorder) Close() error { return nil }
+
+func TestRegisterLogsRedacted(t *testing.T) {
+	var logs bytes.Buffer
+	logger, err := logging.New(&logs, &config.LoggingConfig{Level: "debug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pass := "s3cr3t-password"
+	user := &app.UserPayload{
+		Fullname:           "fullname",
+		Password:           &pass,
+		Email:              "jane.doe@mail.com",
+		Roles:              []string{"user"},
+		SendActivationMail: true,
+	}
+	gock.New(cfg.Services.UserMicroservice.URL).
+		Post("").
+		Reply(201).
+		JSON(map[string]interface{}{
+			"id":         "59804b3c0000000000000001",
+			"fullname":   user.Fullname,
+			"email":      user.Email,
+			"externalId": "qwe04b3c000000qwertydgfsd",
+			"roles":      user.Roles,
+		})
+	gock.New(cfg.Services.UserProfile.URL).
+		Put("/59804b3c0000000000000001").
+		Reply(204)
+
+	gock.InterceptClient(ctrl.Client)
+	test.RegisterUserCreated(t, goa.WithLogger(context.Background(), logger), service, ctrl, nil, user)
+
+	if !strings.Contains(logs.String(), `\"token\":\"[REDACTED]\"`) {
+		t.Fatalf("expected the verification email to be logged without the token, got:\n%s", logs.String())
+	}
+	for _, secret := range []string{user.Email, pass} {
+		if strings.Contains(logs.String(), secret) {
+			t.Fatalf("expected %s to be redacted, got:\n%s", secret, logs.String())
+		}
+	}
 }
 
 // TestRegisterUserInternalServerError tests internal server error scenario
@@ -127,7 +211,7 @@ func TestRegisterUserInternalServerError(t *testing.T) {
 		Roles:      []string{"admin", "user"},
 	}
 
-	gock.New(cfg.Services["user-microservice"]).
+	gock.New(cfg.Services.UserMicroservice.URL).
 		Post("").
 		Reply(500).
 		JSON(map[string]interface{}{
@@ -139,7 +223,7 @@ func TestRegisterUserInternalServerError(t *testing.T) {
 			"active":     false,
 		})
 
-	gock.New(cfg.Services["microservice-user-profile"]).
+	gock.New(cfg.Services.UserProfile.URL).
 		Put(fmt.Sprintf("/%s", "59804b3c0000000000000000")).
 		Reply(500).
 		JSON(map[string]interface{}{
@@ -147,7 +231,7 @@ func TestRegisterUserInternalServerError(t *testing.T) {
 			"email":    user.Email,
 		})
 	gock.InterceptClient(ctrl.Client)
-	test.RegisterUserInternalServerError(t, context.Background(), service, ctrl, user)
+	test.RegisterUserInternalServerError(t, context.Background(), service, ctrl, nil, user)
 }
 
 // Call generated test helper, this checks that the returned media type is of the
@@ -164,7 +248,7 @@ func TestRegisterUserBadRequest(t *testing.T) {
 		Roles:      []string{"admin", "user"},
 	}
 
-	gock.New(cfg.Services["user-microservice"]).
+	gock.New(cfg.Services.UserMicroservice.URL).
 		Post("").
 		Reply(400).
 		JSON(map[string]interface{}{
@@ -176,7 +260,7 @@ func TestRegisterUserBadRequest(t *testing.T) {
 			"active":     false,
 		})
 
-	gock.New(cfg.Services["microservice-user-profile"]).
+	gock.New(cfg.Services.UserProfile.URL).
 		Put(fmt.Sprintf("/%s", "59804b3c0000000000000000")).
 		Reply(400).
 		JSON(map[string]interface{}{
@@ -184,33 +268,74 @@ func TestRegisterUserBadRequest(t *testing.T) {
 			"email":    user.Email,
 		})
 	gock.InterceptClient(ctrl.Client)
-	test.RegisterUserBadRequest(t, context.Background(), service, ctrl, user)
+	test.RegisterUserBadRequest(t, context.Background(), service, ctrl, nil, user)
 }
 
-func TestMakeRequest(t *testing.T) {
+func TestNewRequest(t *testing.T) {
 
 	payload := []byte(`{
 	    "data": "something"
 	  }`)
+	headers := http.Header{"X-Request-Id": []string{"abc"}}
+
+	req, err := newRequest(http.MethodPost, payload, "http://test.com/users", headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != http.MethodPost || req.URL.String() != "http://test.com/users" {
+		t.Fatalf("unexpected request %s %s", req.Method, req.URL)
+	}
+	if req.Header.Get("X-Request-Id") != "abc" {
+		t.Fatal("the additional header was not set")
+	}
+	if req.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("expected a JSON request, got %q", req.Header.Get("Content-Type"))
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != string(payload) {
+		t.Fatalf("unexpected body %s", body)
+	}
+}
+
+func TestServiceRequestAuth(t *testing.T) {
+	defer gock.Off()
 	client := &http.Client{}
+	gock.InterceptClient(client)
+	controller := &UserController{Client: client, Signer: ctrl.Signer}
 
 	gock.New("http://test.com").
-		Post("/users").
-		Reply(201)
+		Get("/basic").
+		MatchHeader("Authorization", "^Basic ").
+		Reply(200)
+	gock.New("http://test.com").
+		Get("/none").
+		Reply(200)
 
-	gock.InterceptClient(client)
-	resp, err := makeRequest(client, http.MethodPost, payload, "http://test.com/users", cfg)
+	basic := config.ServiceConfig{Auth: &config.AuthConfig{Type: config.AuthBasic, Username: "registration", Password: "secret"}}
+	resp, err := controller.serviceRequest(context.Background(), "test", basic, http.MethodGet, nil, "http://test.com/basic", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if resp == nil {
-		t.Fatal("Nil response")
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected basic credentials to be sent, got %d", resp.StatusCode)
+	}
+
+	none := config.ServiceConfig{Auth: &config.AuthConfig{Type: config.AuthNone}, TimeoutMs: 1000}
+	resp, err = controller.serviceRequest(context.Background(), "test", none, http.MethodGet, nil, "http://test.com/none", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Request.Header.Get("Authorization") != "" {
+		t.Fatal("expected no credentials")
 	}
 }
 
 func TestSelfSignJWT(t *testing.T) {
 
-	token, err := selfSignJWT(cfg)
+	token, err := ctrl.Signer.Token(tokenClaims(cfg.Services.UserMicroservice.Token))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -298,3 +423,585 @@ func TestResenVerification_InternalServerError(t *testing.T) {
 		Email: "email@example.com",
 	})
 }
+
+func TestResendVerification_RetriesProfileOnBadGateway(t *testing.T) {
+	gock.Off()
+
+	gock.New("http://kong:8000").
+		Post("/users/verification/reset").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"id":    "user-id",
+			"email": "email@example.com",
+			"token": "verification_token_reset",
+		})
+
+	gock.New("http://kong:8000").
+		Get("/profiles/user-id").
+		Reply(502)
+
+	gock.New("http://kong:8000").
+		Get("/profiles/user-id").
+		Reply(200).JSON(map[string]interface{}{
+		"userId":   "user-id",
+		"email":    "email@example.com",
+		"fullName": "Test User",
+	})
+
+	gock.InterceptClient(ctrl.Client)
+	test.ResendVerificationUserOK(t, context.Background(), service, ctrl, &app.ResendVerificationPayload{
+		Email: "email@example.com",
+	})
+
+	if !gock.IsDone() {
+		t.Fatal("expected the profile to be fetched again after 502")
+	}
+}
+
+// recordingChannel records where the messages are published.
+type recordingChannel struct {
+	rabbitmq.MockAMQPChannel
+	queue    string
+	declared string
+	exchange string
+	key      string
+	headers  amqp.Table
+}
+
+func (r *recordingChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	r.queue = name
+	return amqp.Queue{Name: name}, nil
+}
+
+func (r *recordingChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	r.declared = name
+	return nil
+}
+
+func (r *recordingChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	r.exchange, r.key, r.headers = exchange, key, msg.Headers
+	return nil
+}
+
+func TestPublishRoute(t *testing.T) {
+	messaging := config.MessagingConfig{
+		Routes: map[string]config.RouteConfig{
+			config.MessageInvite: {Exchange: "emails", RoutingKey: "invite"},
+		},
+	}
+
+	ch := &recordingChannel{}
+	if err := publish(context.Background(), ch, config.MessageResend, messaging.Route(config.MessageResend), []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if ch.queue != "verification-email" || ch.exchange != "" || ch.key != "verification-email" {
+		t.Fatalf("expected the resend email on the default exchange to verification-email, got %+v", ch)
+	}
+
+	ch = &recordingChannel{}
+	if err := publish(context.Background(), ch, config.MessageInvite, messaging.Route(config.MessageInvite), []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if ch.declared != "emails" || ch.exchange != "emails" || ch.key != "invite" || ch.queue != "" {
+		t.Fatalf("expected the invitation on the declared emails exchange, got %+v", ch)
+	}
+
+	// a channel that cannot publish with a routing key refuses the route
+	err := publish(context.Background(), &rabbitmq.MockAMQPChannel{}, config.MessageInvite, messaging.Route(config.MessageInvite), []byte("{}"))
+	if err == nil {
+		t.Fatal("expected the routing key not to be dropped")
+	}
+}
+
+func TestPublishTraceContext(t *testing.T) {
+	if _, err := tracing.Setup(nil, "test", ""); err != nil {
+		t.Fatal(err)
+	}
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	ch := &recordingChannel{}
+	if err := publish(ctx, ch, config.MessageVerification, config.MessagingConfig{}.Route(config.MessageVerification), []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	traceparent, _ := ch.headers["traceparent"].(string)
+	if !strings.Contains(traceparent, traceID.String()) {
+		t.Fatalf("expected the trace context in the message headers, got %v", ch.headers)
+	}
+}
+
+func TestReadinessChecker(t *testing.T) {
+	defer gock.Off()
+	gock.New(cfg.Services.UserMicroservice.URL).Reply(404)
+	gock.New(cfg.Services.UserProfile.URL).Reply(503)
+	client := &http.Client{}
+	gock.InterceptClient(client)
+
+	checker := NewReadinessChecker(config.NewStore(cfg), CreateMockAmqpChannel, client, signer.New("system"))
+	report := checker.Run()
+
+	if report.Status != readiness.StatusFailed {
+		t.Fatalf("expected the service not to be ready, got %+v", report)
+	}
+	for check, expected := range map[string]string{
+		CheckAMQP:        readiness.StatusOK,
+		CheckUserService: readiness.StatusOK,
+		CheckUserProfile: readiness.StatusFailed,
+		CheckSystemKey:   readiness.StatusFailed,
+	} {
+		if status := report.Checks[check].Status; status != expected {
+			t.Errorf("expected %s to be %s, got %s", check, expected, status)
+		}
+	}
+}
+
+func TestRegistrationStatus(t *testing.T) {
+	gock.Off()
+	defer gock.Off()
+	userID := "5a1f0b3c0000000000000001"
+	extID := "ext-5a1f0b3c"
+	user := &app.UserPayload{
+		Fullname:   "fullname",
+		Email:      "status@mail.com",
+		ExternalID: &extID,
+		Roles:      []string{"user"},
+	}
+	gock.New(cfg.Services.UserMicroservice.URL).
+		Post("").
+		Reply(201).
+		JSON(map[string]interface{}{
+			"id":         userID,
+			"fullname":   user.Fullname,
+			"email":      user.Email,
+			"externalId": extID,
+			"roles":      []string{"user"},
+			"active":     false,
+		})
+	gock.New(cfg.Services.UserProfile.URL).
+		Put("/" + userID).
+		Reply(204)
+	gock.New(cfg.Services.UserMicroservice.URL).
+		Get("/" + userID).
+		Reply(200).
+		JSON(map[string]interface{}{"id": userID, "active": false})
+	gock.New(cfg.Services.UserMicroservice.URL).
+		Get("/" + userID).
+		Reply(200).
+		JSON(map[string]interface{}{"id": userID, "active": true})
+	gock.InterceptClient(ctrl.Client)
+
+	rw, _ := test.RegisterUserCreated(t, context.Background(), service, ctrl, nil, user)
+	location := rw.Header().Get("Location")
+	if !strings.HasPrefix(location, "/users/register/") {
+		t.Fatalf("expected the status URL in the Location header, got %q", location)
+	}
+	registrationID := strings.Split(location, "/")[3]
+
+	_, status := test.RegistrationStatusUserOK(t, context.Background(), service, ctrl, registrationID)
+	if status.State != string(lifecycle.StateProfileCreated) || status.UserID == nil || *status.UserID != userID {
+		t.Fatalf("expected the profile to be created, got %+v", status)
+	}
+
+	// the status is not served by user ID
+	test.RegistrationStatusUserNotFound(t, context.Background(), service, ctrl, userID)
+
+	// the user did not verify the email address yet
+	test.ConfirmVerificationUserConflict(t, context.Background(), service, ctrl, registrationID)
+	_, status = test.RegistrationStatusUserOK(t, context.Background(), service, ctrl, registrationID)
+	if status.State != string(lifecycle.StateProfileCreated) {
+		t.Fatalf("expected the status not to change the registration, got %+v", status)
+	}
+
+	_, status = test.ConfirmVerificationUserOK(t, context.Background(), service, ctrl, registrationID)
+	if status.ID != registrationID || status.State != string(lifecycle.StateVerified) {
+		t.Fatalf("expected the registration to be verified, got %+v", status)
+	}
+	var states []string
+	for _, transition := range status.History {
+		states = append(states, transition.State)
+	}
+	if strings.Join(states, ",") != "pending,user_created,profile_created,verified" {
+		t.Fatalf("unexpected history %v", states)
+	}
+
+	test.RegistrationStatusUserNotFound(t, context.Background(), service, ctrl, "unknown")
+	test.ConfirmVerificationUserNotFound(t, context.Background(), service, ctrl, "unknown")
+}
+
+func TestRegisterAsync(t *testing.T) {
+	gock.Off()
+	defer gock.Off()
+	userID := "5a1f0b3c0000000000000002"
+	user := &app.UserPayload{
+		Fullname:           "fullname",
+		Email:              "async@mail.com",
+		Roles:              []string{"user"},
+		SendActivationMail: true,
+	}
+	// the first attempt fails and the idempotent creation is retried with the same key
+	ctrl.Retrier.IdempotentCreate = true
+	defer func() { ctrl.Retrier.IdempotentCreate = false }()
+	gock.New(cfg.Services.UserMicroservice.URL).
+		Post("").
+		MatchHeader("Idempotency-Key", ".+").
+		Reply(500).
+		JSON(map[string]interface{}{"code": "internal", "status": 500, "detail": "database is down"})
+	gock.New(cfg.Services.UserMicroservice.URL).
+		Post("").
+		MatchHeader("Idempotency-Key", ".+").
+		Reply(201).
+		JSON(map[string]interface{}{
+			"id":       userID,
+			"fullname": user.Fullname,
+			"email":    user.Email,
+			"roles":    []string{"user"},
+			"active":   false,
+		})
+	gock.New(cfg.Services.UserProfile.URL).
+		Put("/" + userID).
+		Reply(204)
+	gock.InterceptClient(ctrl.Client)
+
+	ctrl.Async = NewAsyncRegistrar(ctrl, &config.AsyncConfig{Workers: 1, BackoffMs: 1})
+	defer func() {
+		ctrl.Async.Close(context.Background())
+		ctrl.Async = nil
+	}()
+	async := true
+	rw, status := test.RegisterUserAccepted(t, context.Background(), service, ctrl, &async, user)
+	if status.State != string(lifecycle.StatePending) || rw.Header().Get("Location") != "/users/register/"+status.ID+"/status" {
+		t.Fatalf("expected the pending registration and its status URL, got %+v, %s", status, rw.Header().Get("Location"))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		record, err := ctrl.Tracker.Store.Get(status.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.State == lifecycle.StateMailQueued {
+			if record.UserID != userID {
+				t.Fatalf("expected the created user in the record, got %+v", record)
+			}
+			break
+		}
+		if record.State == lifecycle.StateFailed || time.Now().After(deadline) {
+			t.Fatalf("expected the registration to be retried until the mail was queued, got %+v", record)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// a request can ask for the synchronous registration
+	async = false
+	ctrl.Async.Default = true
+	gock.New(cfg.Services.UserMicroservice.URL).
+		Post("").
+		Reply(400).
+		JSON(map[string]interface{}{"code": "bad_request", "status": 400, "detail": "email already registered"})
+	test.RegisterUserBadRequest(t, context.Background(), service, ctrl, &async, user)
+}
+
+func TestRegisterAsyncCreateTimeout(t *testing.T) {
+	// the user microservice creates the user, but responds after the client gave up
+	created := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		created <- struct{}{}
+		time.Sleep(200 * time.Millisecond)
+		rw.WriteHeader(http.StatusCreated)
+		json.NewEncoder(rw).Encode(map[string]interface{}{"id": "5a1f0b3c0000000000000005", "email": "timeout@mail.com"})
+	}))
+	defer server.Close()
+	timeoutCfg := *cfg
+	timeoutCfg.Services = config.ServicesConfig{
+		UserMicroservice: config.ServiceConfig{URL: server.URL + "/users"},
+		UserProfile:      config.ServiceConfig{URL: server.URL + "/profiles"},
+	}
+	client := &http.Client{Transport: &http.Transport{}, Timeout: 50 * time.Millisecond}
+	controller := NewUserController(service, config.NewStore(&timeoutCfg), CreateMockAmqpChannel, client)
+	controller.Async = NewAsyncRegistrar(controller, &config.AsyncConfig{Workers: 1, MaxAttempts: 3, BackoffMs: 1})
+	defer controller.Async.Close(context.Background())
+
+	async := true
+	_, status := test.RegisterUserAccepted(t, context.Background(), service, controller, &async, &app.UserPayload{
+		Fullname: "fullname",
+		Email:    "timeout@mail.com",
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		record, err := controller.Tracker.Store.Get(status.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.State == lifecycle.StateFailed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the registration to fail, got %+v", record)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(created) != 1 {
+		t.Fatalf("expected the user to be created once, got %d create requests", len(created))
+	}
+}
+
+func TestAsyncCloseDeadline(t *testing.T) {
+	a := NewAsyncRegistrar(ctrl, &config.AsyncConfig{Workers: 1})
+	// a registration that does not finish in time
+	a.wg.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := a.Close(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected Close to stop waiting at the deadline, got %v", err)
+	}
+	a.wg.Done()
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegisterCompensation(t *testing.T) {
+	gock.Off()
+	defer gock.Off()
+	userID := "5a1f0b3c0000000000000003"
+	user := &app.UserPayload{
+		Fullname:           "fullname",
+		Email:              "compensation@mail.com",
+		Roles:              []string{"user"},
+		SendActivationMail: true,
+	}
+	gock.New(cfg.Services.UserMicroservice.URL).
+		Post("").
+		Reply(201).
+		JSON(map[string]interface{}{"id": userID, "fullname": user.Fullname, "email": user.Email, "roles": []string{"user"}})
+	gock.New(cfg.Services.UserProfile.URL).
+		Put("/" + userID).
+		Reply(400).
+		JSON(map[string]interface{}{"code": "bad_request", "status": 400, "detail": "invalid profile"})
+	gock.New(cfg.Services.UserMicroservice.URL).
+		Delete("/" + userID).
+		Reply(204)
+	gock.InterceptClient(ctrl.Client)
+	published := &recordingChannel{}
+	createAmqpChannel := ctrl.createAmqpChannel
+	ctrl.createAmqpChannel = func(*config.Config) (*amqp.Connection, rabbitmq.Channel, error) {
+		return nil, published, nil
+	}
+	defer func() { ctrl.createAmqpChannel = createAmqpChannel }()
+
+	test.RegisterUserBadRequest(t, context.Background(), service, ctrl, nil, user)
+	if !gock.IsDone() {
+		t.Fatal("expected the created user to be deleted")
+	}
+	if published.queue != "" || published.key != "" {
+		t.Fatalf("expected no verification email for the failed registration, got %+v", published)
+	}
+	record, err := ctrl.Tracker.Store.FindByUserID(userID)
+	if err != nil || record.State != lifecycle.StateFailed || record.Error != metrics.ErrorProfileRejected {
+		t.Fatalf("expected the registration to fail, got %+v, %v", record, err)
+	}
+}
+
+func TestRegisterCompensationDeletesProfile(t *testing.T) {
+	gock.Off()
+	defer gock.Off()
+	userID := "5a1f0b3c0000000000000006"
+	user := &app.UserPayload{
+		Fullname:           "fullname",
+		Email:              "profile-compensation@mail.com",
+		Roles:              []string{"user"},
+		SendActivationMail: true,
+	}
+	gock.New(cfg.Services.UserMicroservice.URL).
+		Post("").
+		Reply(201).
+		JSON(map[string]interface{}{"id": userID, "fullname": user.Fullname, "email": user.Email, "roles": []string{"user"}})
+	gock.New(cfg.Services.UserProfile.URL).
+		Put("/" + userID).
+		Reply(204)
+	gock.New(cfg.Services.UserProfile.URL).
+		Delete("/" + userID).
+		Reply(204)
+	gock.New(cfg.Services.UserMicroservice.URL).
+		Delete("/" + userID).
+		Reply(204)
+	gock.InterceptClient(ctrl.Client)
+	// the email cannot be sent once the profile was created
+	createAmqpChannel := ctrl.createAmqpChannel
+	ctrl.createAmqpChannel = func(*config.Config) (*amqp.Connection, rabbitmq.Channel, error) {
+		time.Sleep(20 * time.Millisecond)
+		return nil, nil, fmt.Errorf("broker is down")
+	}
+	defer func() { ctrl.createAmqpChannel = createAmqpChannel }()
+
+	test.RegisterUserInternalServerError(t, context.Background(), service, ctrl, nil, user)
+	if !gock.IsDone() {
+		t.Fatal("expected the created user and user profile to be deleted")
+	}
+}
+
+// slowChannel is the channel of a remote broker, whose publishes take latency.
+type slowChannel struct {
+	rabbitmq.MockAMQPChannel
+	latency time.Duration
+}
+
+func (s *slowChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	return amqp.Queue{Name: name}, nil
+}
+
+func (s *slowChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	return nil
+}
+
+func (s *slowChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	time.Sleep(s.latency)
+	return nil
+}
+
+// benchmarkLatency is the latency of the downstream calls, of opening an AMQP connection
+// and of publishing the email.
+type benchmarkLatency struct {
+	call, dial, publish time.Duration
+}
+
+// benchmarkController returns a controller whose downstream calls and AMQP operations take
+// the given latencies.
+func benchmarkController(latency benchmarkLatency) (*UserController, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(latency.call)
+		if req.Method == http.MethodPost {
+			rw.WriteHeader(http.StatusCreated)
+			json.NewEncoder(rw).Encode(map[string]interface{}{"id": "5a1f0b3c0000000000000004", "email": "bench@mail.com"})
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	benchCfg := *cfg
+	benchCfg.Services = config.ServicesConfig{
+		UserMicroservice: config.ServiceConfig{URL: server.URL + "/users"},
+		UserProfile:      config.ServiceConfig{URL: server.URL + "/profiles"},
+	}
+	factory := func(*config.Config) (*amqp.Connection, rabbitmq.Channel, error) {
+		time.Sleep(latency.dial)
+		return nil, &slowChannel{latency: latency.publish}, nil
+	}
+	controller := NewUserController(service, config.NewStore(&benchCfg), factory, &http.Client{Transport: &http.Transport{}})
+	return controller, server.Close
+}
+
+// registerLatency is the latency of the registration benchmarks: only the profile call
+// and the dial overlap, the create call comes before them and the publish after them.
+var registerLatency = benchmarkLatency{call: 20 * time.Millisecond, dial: 20 * time.Millisecond, publish: 5 * time.Millisecond}
+
+func benchmarkPayload() *app.UserPayload {
+	return &app.UserPayload{Fullname: "fullname", Email: "bench@mail.com", SendActivationMail: true}
+}
+
+// BenchmarkRegisterSequential runs the registration steps one after the other, as a
+// baseline for BenchmarkRegister.
+func BenchmarkRegisterSequential(b *testing.B) {
+	controller, stop := benchmarkController(registerLatency)
+	defer stop()
+	ctx := context.Background()
+	cfg := controller.Store.Get()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		job, err := controller.newRegistrationJob(benchmarkPayload(), "")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if job.user, err = controller.createUser(ctx, cfg, job); err != nil {
+			b.Fatal(err)
+		}
+		if err := controller.updateUserProfile(ctx, cfg, job.user); err != nil {
+			b.Fatal(err)
+		}
+		mail, err := controller.prepareVerificationMail(ctx, cfg, job)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := controller.sendVerificationMail(ctx, mail); err != nil {
+			b.Fatal(err)
+		}
+		controller.closeAmqpConnection(mail.conn)
+	}
+}
+
+// BenchmarkRegister runs the registration with the profile created while the connection
+// of the email is opened. The publish is still the last step, so it gains the dial
+// latency over BenchmarkRegisterSequential and nothing else.
+func BenchmarkRegister(b *testing.B) {
+	controller, stop := benchmarkController(registerLatency)
+	defer stop()
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		job, err := controller.newRegistrationJob(benchmarkPayload(), "")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := controller.runRegistration(ctx, job); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	shutdownService := goa.New("shutdown-test")
+	started := make(chan struct{})
+	shutdownService.Server.Handler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		rw.WriteHeader(http.StatusCreated)
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go shutdownService.Serve(l)
+
+	// not http.DefaultClient, its transport is intercepted by gock
+	client := &http.Client{Transport: &http.Transport{}}
+	steps := []string{}
+	responses := make(chan int, 1)
+	go func() {
+		resp, err := client.Get("http://" + l.Addr().String())
+		if err != nil {
+			responses <- 0
+			return
+		}
+		responses <- resp.StatusCode
+	}()
+	<-started
+
+	shutdown := &Shutdown{
+		Service:     shutdownService,
+		GracePeriod: 5 * time.Second,
+		Unregister: func(ctx context.Context) error {
+			steps = append(steps, "unregister")
+			return nil
+		},
+		Drain: []func(context.Context) error{func(ctx context.Context) error {
+			steps = append(steps, "drain")
+			return nil
+		}},
+		Close: []func(){func() { steps = append(steps, "close") }},
+	}
+	shutdown.Run()
+
+	if status := <-responses; status != http.StatusCreated {
+		t.Fatalf("expected the in-flight request to complete, got %d", status)
+	}
+	if strings.Join(steps, ",") != "unregister,drain,close" {
+		t.Fatalf("unexpected shutdown steps %v", steps)
+	}
+	if _, err := client.Get("http://" + l.Addr().String()); err == nil {
+		t.Fatal("expected new requests to be refused")
+	}
+}